@@ -0,0 +1,1070 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/cli"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/nfi-hashicorp/yaml2tf/convert"
+	"github.com/nfi-hashicorp/yaml2tf/terraformfmt"
+	"github.com/posener/complete"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "0.0.0-dev"
+
+// Exit codes, shared by every command.
+const (
+	exitOK = 0
+	// exitError means the command failed, e.g. the YAML was invalid.
+	exitError = 1
+	// exitUsage means the command line was invalid.
+	exitUsage = 2
+	// exitChanged means a check found something out of date: fmt -check found
+	// unformatted files, or check found stale outputs.
+	exitChanged = 3
+)
+
+func realMain(args []string) int {
+	m := &meta{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	return m.run(args)
+}
+
+// meta holds what every command needs; mostly where to read and write, so
+// tests can capture it.
+type meta struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (m *meta) run(args []string) int {
+	commands := map[string]cli.CommandFactory{
+		"convert": func() (cli.Command, error) {
+			return &convertCommand{meta: m}, nil
+		},
+		"check": func() (cli.Command, error) {
+			return &checkCommand{meta: m}, nil
+		},
+		"fmt": func() (cli.Command, error) {
+			return &fmtCommand{meta: m}, nil
+		},
+		"tf2yaml": func() (cli.Command, error) {
+			return &tf2yamlCommand{meta: m}, nil
+		},
+		"insert": func() (cli.Command, error) {
+			return &insertCommand{meta: m}, nil
+		},
+		"migrate": func() (cli.Command, error) {
+			return &migrateCommand{meta: m}, nil
+		},
+		"version": func() (cli.Command, error) {
+			return &versionCommand{meta: m}, nil
+		},
+	}
+	c := &cli.CLI{
+		Name:                  "yaml2tf",
+		Version:               version,
+		Args:                  args,
+		Commands:              commands,
+		HelpFunc:              cli.BasicHelpFunc("yaml2tf"),
+		HelpWriter:            m.Stdout,
+		ErrorWriter:           m.Stderr,
+		Autocomplete:          true,
+		AutocompleteInstall:   "install-autocomplete",
+		AutocompleteUninstall: "uninstall-autocomplete",
+	}
+	commands["help"] = func() (cli.Command, error) {
+		return &helpCommand{meta: m, commands: commands, helpFunc: c.HelpFunc}, nil
+	}
+
+	code, err := c.Run()
+	if err != nil {
+		fmt.Fprintf(m.Stderr, "Error: %s\n", err)
+		return exitError
+	}
+	if code == 127 {
+		// cli's code for an unknown command, having printed the help.
+		return exitUsage
+	}
+	return code
+}
+
+// flagSet returns a FlagSet for the command that prints its help on errors.
+func (m *meta) flagSet(name string, c cli.Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(m.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(m.Stderr, strings.TrimSpace(c.Help()))
+	}
+	return fs
+}
+
+func (m *meta) errorf(format string, args ...any) {
+	fmt.Fprintf(m.Stderr, "Error: "+format+"\n", args...)
+}
+
+// convertFlags are the flags for commands that convert YAML.
+type convertFlags struct {
+	nulls     string
+	aliases   string
+	documents string
+	template  string
+	target    string
+	name      string
+	encode    string
+	flowWidth int
+	preserve  bool
+	verify    bool
+	include   stringsFlag
+	exclude   stringsFlag
+	outDir    string
+}
+
+func (f *convertFlags) addTo(fs *flag.FlagSet) {
+	fs.StringVar(&f.nulls, "null", "null", "")
+	fs.StringVar(&f.aliases, "aliases", "expand", "")
+	fs.StringVar(&f.documents, "documents", "tuple", "")
+	fs.StringVar(&f.template, "template", "literal", "")
+	fs.StringVar(&f.target, "target", "", "")
+	fs.StringVar(&f.name, "name", "", "")
+	fs.StringVar(&f.encode, "encode", "none", "")
+	fs.BoolVar(&f.verify, "verify", false, "")
+	fs.IntVar(&f.flowWidth, "flow-width", 0, "")
+	fs.BoolVar(&f.preserve, "preserve-style", false, "")
+	fs.Var(&f.include, "include", "")
+	fs.Var(&f.exclude, "exclude", "")
+	fs.StringVar(&f.outDir, "out-dir", "", "")
+}
+
+func (f *convertFlags) options() (convert.Options, error) {
+	opts := convert.Options{Filename: "<stdin>"}
+	var err error
+	if opts.Nulls, err = convert.ParseNullMode(f.nulls); err != nil {
+		return opts, err
+	}
+	if opts.Aliases, err = convert.ParseAliasMode(f.aliases); err != nil {
+		return opts, err
+	}
+	if opts.Documents, err = convert.ParseDocumentsMode(f.documents); err != nil {
+		return opts, err
+	}
+	if opts.Templates, err = convert.ParseTemplateMode(f.template); err != nil {
+		return opts, err
+	}
+	if opts.Target, err = convert.ParseTargetMode(f.target); err != nil {
+		return opts, err
+	}
+	k8s := opts.Target == convert.TargetKubernetesManifest && opts.Documents == convert.DocumentsKubernetesManifest
+	if opts.Target != convert.TargetExpr && opts.Documents != convert.DocumentsTuple && !k8s {
+		return opts, fmt.Errorf("can't use -target=%s with -documents=%s; only a single value can be wrapped", f.target, f.documents)
+	}
+	if opts.Target.Constant() && opts.Aliases == convert.AliasLocals {
+		return opts, fmt.Errorf("can't use -target=%s with -aliases=locals; its value can't refer to locals", f.target)
+	}
+	if opts.Target.Constant() && opts.Templates != convert.TemplateLiteral {
+		return opts, fmt.Errorf("can't use -target=%s with -template=%s; its value can't have interpolations", f.target, f.template)
+	}
+	if opts.Encode, err = convert.ParseEncodeMode(f.encode); err != nil {
+		return opts, err
+	}
+	if opts.Encode != convert.EncodeNone && opts.Documents != convert.DocumentsTuple {
+		return opts, fmt.Errorf("can't use -encode=%s with -documents=%s; only a single value can be encoded", f.encode, f.documents)
+	}
+	if opts.Encode != convert.EncodeNone && opts.Target == convert.TargetKubernetesManifest {
+		return opts, fmt.Errorf("can't use -encode=%s with -target=%s; each manifest must be an object", f.encode, f.target)
+	}
+	if opts.Encode != convert.EncodeNone && opts.Target.Constant() {
+		return opts, fmt.Errorf("can't use -encode=%s with -target=%s; its value can't call functions", f.encode, f.target)
+	}
+	if f.name != "" && !hclsyntax.ValidIdentifier(f.name) {
+		return opts, fmt.Errorf("invalid name %q; must be a valid Terraform identifier", f.name)
+	}
+	if f.name != "" && (opts.Target == convert.TargetKubernetesManifest || opts.Documents == convert.DocumentsKubernetesManifest) {
+		return opts, fmt.Errorf("can't use -name with kubernetes_manifest; each resource is named after its manifest")
+	}
+	opts.Name = f.name
+	if f.flowWidth < 0 {
+		return opts, fmt.Errorf("invalid flow width %d; must not be negative", f.flowWidth)
+	}
+	opts.FlowWidth = f.flowWidth
+	opts.PreserveStyle = f.preserve
+	if f.verify && opts.Templates != convert.TemplateLiteral {
+		return opts, fmt.Errorf("can't use -verify with -template=%s; the values depend on template variables", f.template)
+	}
+	opts.Verify = f.verify
+	return opts, nil
+}
+
+func (f *convertFlags) autocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-null":           complete.PredictSet(mapKeys(convert.NullModes)...),
+		"-aliases":        complete.PredictSet(mapKeys(convert.AliasModes)...),
+		"-documents":      complete.PredictSet(mapKeys(convert.DocumentsModes)...),
+		"-template":       complete.PredictSet(mapKeys(convert.TemplateModes)...),
+		"-target":         complete.PredictSet(mapKeys(convert.TargetModes)...),
+		"-name":           complete.PredictAnything,
+		"-encode":         complete.PredictSet(mapKeys(convert.EncodeModes)...),
+		"-flow-width":     complete.PredictAnything,
+		"-preserve-style": complete.PredictNothing,
+		"-verify":         complete.PredictNothing,
+		"-include":        complete.PredictAnything,
+		"-exclude":        complete.PredictAnything,
+		"-out-dir":        complete.PredictDirs("*"),
+	}
+}
+
+const convertFlagsHelp = `
+  -null=MODE          How to convert YAML nulls: null (the default), omit to
+                      drop map entries, or empty-string, empty-list or
+                      empty-map to substitute an empty value.
+
+  -aliases=MODE       How to convert YAML aliases: expand (the default) to
+                      copy the anchored value, or locals to hoist it into a
+                      local value and refer to that.
+
+  -documents=MODE     How to convert several YAML documents: tuple (the
+                      default), locals, named NAME_0, NAME_1 and so on after
+                      -name, or kubernetes_manifest, the same as
+                      -target=kubernetes_manifest.
+
+  -template=MODE      What to do with Terraform template sequences, like
+                      ${HOME} or %{if}, in YAML strings: literal (the
+                      default) to escape them, or template to keep them as
+                      Terraform interpolations and directives. Either way,
+                      each string that has them is warned about.
+
+                      templatefile treats the input as a source for
+                      Terraform's templatefile function: strings that are
+                      just "${name}" become bare references, and %{ for }
+                      and %{ if } directives on lines of their own around
+                      list items become for expressions and conditionals.
+
+  -target=SHAPE       What to wrap the value in: expr for the bare value, or
+                      locals, variable or output for a block of that kind,
+                      or tfvars for a .tfvars assignment, which is written
+                      to <name>.tfvars rather than <name>.tf. Defaults to
+                      expr for standard input, and locals for paths, which
+                      can't use expr.
+
+                      kubernetes_manifest converts each document into a
+                      kubernetes_manifest resource, named
+                      <kind>_<namespace>_<name> after the manifest.
+
+  -name=NAME          The name for -target to give the value. Defaults to
+                      the input file's name as an identifier, or "value" on
+                      standard input.
+
+  -encode=FUNC        Wrap the value in a call that encodes it as a string:
+                      yamlencode or jsonencode, or cloud-config for
+                      "#cloud-config\n${yamlencode(...)}", ready for
+                      user_data. Defaults to none.
+
+  -flow-width=N       Wrap YAML flow collections, like [80, 443], that would
+                      make their line, counting its indentation and key,
+                      wider than N characters. Defaults to 0, which keeps
+                      them on one line however wide.
+
+  -preserve-style     Record how each YAML string was quoted, as a comment
+                      like /* yaml:single */ before it, so that it can be
+                      quoted the same way when converted back.
+
+  -verify             Check that the Terraform evaluates to the same values
+                      that Terraform's yamldecode gives for the YAML, and
+                      fail with each difference if it doesn't.
+
+  -include=GLOB       Convert files matching GLOB when walking directories.
+                      Can be repeated. Defaults to *.yaml and *.yml.
+
+  -exclude=GLOB       Skip files and directories matching GLOB when walking
+                      directories. Can be repeated.
+
+  -out-dir=DIR        Put output files in DIR, instead of next to each
+                      source.
+`
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// predictYAMLPaths completes YAML files and directories to walk.
+var predictYAMLPaths = complete.PredictOr(
+	complete.PredictFiles("*.yaml"),
+	complete.PredictFiles("*.yml"),
+	complete.PredictDirs("*"),
+)
+
+// defaultTarget fills in -target if it wasn't given: expr for standard input,
+// but locals for files, since a file written next to the YAML must be valid
+// Terraform on its own, which a bare value isn't. For the same reason, expr
+// can't be asked for with files.
+func (f *convertFlags) defaultTarget(files bool) error {
+	alone := f.documents != "tuple"
+	switch {
+	case f.target == "" && files && !alone:
+		f.target = "locals"
+	case f.target == "":
+		f.target = "expr"
+	case f.target == "expr" && files && !alone:
+		return fmt.Errorf("can't use -target=expr with paths; a bare value isn't valid Terraform on its own")
+	}
+	return nil
+}
+
+// outputExt is the extension of the files that inputs convert to.
+func (f *convertFlags) outputExt() string {
+	if f.target == "tfvars" {
+		return ".tfvars"
+	}
+	return ".tf"
+}
+
+// convertEach converts each input in turn, printing diagnostics, and calls fn
+// with the output of every one that converts cleanly. It reports whether they
+// all did.
+func (m *meta) convertEach(inputs []input, opts convert.Options, fn func(in input, out []byte) error) bool {
+	ok := true
+	for _, in := range inputs {
+		yb, err := os.ReadFile(in.Path)
+		if err != nil {
+			m.errorf("%s", err)
+			ok = false
+			continue
+		}
+		fileOpts := opts
+		fileOpts.Filename = in.Path
+		out, diags := convert.New(fileOpts).ConvertBytes(yb)
+		printDiagnostics(m.Stderr, diags, map[string][]byte{in.Path: yb})
+		if diags.HasErrors() {
+			ok = false
+			continue
+		}
+		if out == nil {
+			continue
+		}
+		if err := fn(in, append(bytes.TrimRight(out, "\n"), '\n')); err != nil {
+			m.errorf("%s", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+type convertCommand struct {
+	meta  *meta
+	flags convertFlags
+	force bool
+}
+
+func (c *convertCommand) Synopsis() string {
+	return "Convert YAML into Terraform"
+}
+
+func (c *convertCommand) Help() string {
+	return `
+Usage: yaml2tf convert [options] [PATH...]
+
+  Converts YAML files, or directories of them, into Terraform, keeping
+  comments, key order and quoting.
+
+  Each file is written to <name>.tf next to it, or under -out-dir. Files
+  that have been edited since yaml2tf generated them, or that it didn't
+  generate, are not overwritten unless -force is given.
+
+  With no paths, converts standard input to standard output.
+
+Options:
+` + convertFlagsHelp + `
+  -force              Overwrite output files even if they have been edited.
+`
+}
+
+func (c *convertCommand) AutocompleteArgs() complete.Predictor {
+	return predictYAMLPaths
+}
+
+func (c *convertCommand) AutocompleteFlags() complete.Flags {
+	flags := c.flags.autocompleteFlags()
+	flags["-force"] = complete.PredictNothing
+	return flags
+}
+
+func (c *convertCommand) Run(args []string) int {
+	fs := c.meta.flagSet("convert", c)
+	c.flags.addTo(fs)
+	fs.BoolVar(&c.force, "force", false, "")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := c.flags.defaultTarget(fs.NArg() > 0); err != nil {
+		c.meta.errorf("%s", err)
+		return exitUsage
+	}
+	opts, err := c.flags.options()
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		if opts.Name == "" {
+			opts.Name = "value"
+		}
+		yb, err := io.ReadAll(c.meta.Stdin)
+		if err != nil {
+			c.meta.errorf("reading input: %s", err)
+			return exitError
+		}
+		out, diags := convert.New(opts).ConvertBytes(yb)
+		printDiagnostics(c.meta.Stderr, diags, map[string][]byte{opts.Filename: yb})
+		if diags.HasErrors() {
+			return exitError
+		}
+		if out != nil {
+			fmt.Fprintln(c.meta.Stdout, string(bytes.TrimRight(out, "\n")))
+		}
+		return exitOK
+	}
+
+	inputs, err := collectInputs(fs.Args(), c.flags.include, c.flags.exclude, c.flags.outDir, c.flags.outputExt())
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+	ok := c.meta.convertEach(inputs, opts, func(in input, out []byte) error {
+		return writeOutput(in.Output, in.Path, out, c.force)
+	})
+	if !ok {
+		return exitError
+	}
+	return exitOK
+}
+
+type checkCommand struct {
+	meta  *meta
+	flags convertFlags
+}
+
+func (c *checkCommand) Synopsis() string {
+	return "Check that YAML converts cleanly and outputs are up to date"
+}
+
+func (c *checkCommand) Help() string {
+	return `
+Usage: yaml2tf check [options] [PATH...]
+
+  Converts YAML like the convert command, but only reports problems
+  instead of writing anything.
+
+  With paths, also checks that the .tf file for each one is up to date,
+  listing any that are missing, stale or edited by hand.
+
+  With no paths, checks standard input.
+
+  Exits with status 1 if any YAML can't be converted, or 3 if it all can
+  but some .tf files are out of date.
+
+Options:
+` + convertFlagsHelp
+}
+
+func (c *checkCommand) AutocompleteArgs() complete.Predictor {
+	return predictYAMLPaths
+}
+
+func (c *checkCommand) AutocompleteFlags() complete.Flags {
+	return c.flags.autocompleteFlags()
+}
+
+func (c *checkCommand) Run(args []string) int {
+	fs := c.meta.flagSet("check", c)
+	c.flags.addTo(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := c.flags.defaultTarget(fs.NArg() > 0); err != nil {
+		c.meta.errorf("%s", err)
+		return exitUsage
+	}
+	opts, err := c.flags.options()
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		yb, err := io.ReadAll(c.meta.Stdin)
+		if err != nil {
+			c.meta.errorf("reading input: %s", err)
+			return exitError
+		}
+		_, diags := convert.New(opts).ConvertBytes(yb)
+		printDiagnostics(c.meta.Stderr, diags, map[string][]byte{opts.Filename: yb})
+		if diags.HasErrors() {
+			return exitError
+		}
+		return exitOK
+	}
+
+	inputs, err := collectInputs(fs.Args(), c.flags.include, c.flags.exclude, c.flags.outDir, c.flags.outputExt())
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+	stale := false
+	ok := c.meta.convertEach(inputs, opts, func(in input, out []byte) error {
+		existing, err := os.ReadFile(in.Output)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if !bytes.Equal(existing, outputFile(in.Output, in.Path, out)) {
+			fmt.Fprintln(c.meta.Stdout, in.Output)
+			stale = true
+		}
+		return nil
+	})
+	switch {
+	case !ok:
+		return exitError
+	case stale:
+		return exitChanged
+	default:
+		return exitOK
+	}
+}
+
+type fmtCommand struct {
+	meta *meta
+}
+
+func (c *fmtCommand) Synopsis() string {
+	return "Format Terraform files like terraform fmt"
+}
+
+func (c *fmtCommand) Help() string {
+	return `
+Usage: yaml2tf fmt [options] [PATH...]
+
+  Rewrites Terraform configuration files (.tf and .tfvars) to the
+  canonical format, the same way terraform fmt does, for when terraform
+  itself isn't available.
+
+  PATH may be files or directories, and defaults to the current directory.
+  Directories are only searched recursively with -recursive.
+
+Options:
+
+  -list=false         Don't list files whose formatting differs.
+
+  -write=false        Don't write to source files.
+
+  -diff               Display diffs of formatting changes.
+
+  -check              Check if the input is formatted, without writing.
+                      Exits with status 3 if any file isn't.
+
+  -recursive          Also process files in subdirectories.
+`
+}
+
+func (c *fmtCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictOr(
+		complete.PredictFiles("*.tf"),
+		complete.PredictFiles("*.tfvars"),
+		complete.PredictDirs("*"),
+	)
+}
+
+func (c *fmtCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-list":      complete.PredictSet("true", "false"),
+		"-write":     complete.PredictSet("true", "false"),
+		"-diff":      complete.PredictNothing,
+		"-check":     complete.PredictNothing,
+		"-recursive": complete.PredictNothing,
+	}
+}
+
+func (c *fmtCommand) Run(args []string) int {
+	flags := c.meta.flagSet("fmt", c)
+	list := flags.Bool("list", true, "")
+	write := flags.Bool("write", true, "")
+	diff := flags.Bool("diff", false, "")
+	check := flags.Bool("check", false, "")
+	recursive := flags.Bool("recursive", false, "")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *check {
+		*write = false
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFiles(paths, *recursive, ".tf", ".tfvars")
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+
+	ok, changed := true, false
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			c.meta.errorf("%s", err)
+			ok = false
+			continue
+		}
+		out, diags := terraformfmt.FormatSource(src, path)
+		printDiagnostics(c.meta.Stderr, diags, map[string][]byte{path: src})
+		if diags.HasErrors() {
+			ok = false
+			continue
+		}
+		if bytes.Equal(src, out) {
+			continue
+		}
+		changed = true
+		if *list {
+			fmt.Fprintln(c.meta.Stdout, path)
+		}
+		if *diff {
+			d, err := terraformfmt.BytesDiff(src, out, path)
+			if err != nil {
+				c.meta.errorf("diffing %s: %s", path, err)
+				ok = false
+			}
+			c.meta.Stdout.Write(d)
+		}
+		if *write {
+			if err := os.WriteFile(path, out, 0o644); err != nil {
+				c.meta.errorf("%s", err)
+				ok = false
+			}
+		}
+	}
+	switch {
+	case !ok:
+		return exitError
+	case *check && changed:
+		return exitChanged
+	default:
+		return exitOK
+	}
+}
+
+type tf2yamlCommand struct {
+	meta *meta
+}
+
+func (c *tf2yamlCommand) Synopsis() string {
+	return "Convert Terraform written by yaml2tf back into YAML"
+}
+
+func (c *tf2yamlCommand) Help() string {
+	return `
+Usage: yaml2tf tf2yaml [options] [PATH]
+
+  Converts a Terraform value back into YAML, keeping comments and key
+  order. Heredocs become block scalars, references to local values become
+  aliases, and merge() becomes a merge key. Strings are quoted the way
+  -preserve-style recorded, if it was used.
+
+  PATH, or standard input, is either a bare value, as convert writes by
+  default, or a Terraform file with the value in a local value, a variable
+  default, an output, a top-level attribute or kubernetes_manifest
+  resources, as convert writes with -target. The YAML is written to
+  standard output.
+
+Options:
+
+  -name=NAME          Which value to convert, if the file has several.
+                      Without it, every kubernetes_manifest resource in
+                      the file becomes a YAML document of its own.
+`
+}
+
+func (c *tf2yamlCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictOr(
+		complete.PredictFiles("*.tf"),
+		complete.PredictFiles("*.tfvars"),
+	)
+}
+
+func (c *tf2yamlCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-name": complete.PredictAnything,
+	}
+}
+
+func (c *tf2yamlCommand) Run(args []string) int {
+	fs := c.meta.flagSet("tf2yaml", c)
+	name := fs.String("name", "", "")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		c.meta.errorf("tf2yaml converts a single file; got %d", fs.NArg())
+		return exitUsage
+	}
+
+	var src []byte
+	var err error
+	filename := "<stdin>"
+	if fs.NArg() == 1 {
+		filename = fs.Arg(0)
+		src, err = os.ReadFile(filename)
+	} else {
+		src, err = io.ReadAll(c.meta.Stdin)
+	}
+	if err != nil {
+		c.meta.errorf("reading input: %s", err)
+		return exitError
+	}
+	out, diags := convert.ToYAML(src, filename, *name)
+	printDiagnostics(c.meta.Stderr, diags, map[string][]byte{filename: src})
+	if diags.HasErrors() {
+		return exitError
+	}
+	c.meta.Stdout.Write(out)
+	return exitOK
+}
+
+type insertCommand struct {
+	meta  *meta
+	flags convertFlags
+}
+
+func (c *insertCommand) Synopsis() string {
+	return "Set an attribute in a Terraform file to converted YAML"
+}
+
+func (c *insertCommand) Help() string {
+	return `
+Usage: yaml2tf insert [options] FILE ADDRESS [PATH]
+
+  Converts the YAML in PATH, or standard input, and sets the attribute at
+  ADDRESS in the Terraform file FILE to it, leaving the rest of the file
+  exactly as it was.
+
+  ADDRESS is the block's type and labels, any nested blocks, and the
+  attribute's name, separated by dots, like
+  resource.aws_instance.web.user_data or locals.cloud_init, or just a name
+  for a top-level attribute, as in a .tfvars file. An existing attribute
+  has its value replaced; otherwise the attribute is added to the end of
+  its block. A locals block is added if there isn't one, but any other
+  block must already exist.
+
+  Aliases are always expanded, since there's nowhere to put locals.
+
+Options:
+
+  -null=MODE          How to convert YAML nulls: null (the default), omit to
+                      drop map entries, or empty-string, empty-list or
+                      empty-map to substitute an empty value.
+
+  -template=MODE      What to do with Terraform template sequences in YAML
+                      strings: literal (the default), template or
+                      templatefile, as for convert.
+
+  -encode=FUNC        Wrap the value in yamlencode, jsonencode or
+                      cloud-config, as for convert. Defaults to none.
+
+  -flow-width=N       Wrap YAML flow collections whose line would be wider
+                      than N characters.
+
+  -preserve-style     Record how each YAML string was quoted.
+
+  -verify             Check that the Terraform evaluates to the same values
+                      that Terraform's yamldecode gives for the YAML.
+`
+}
+
+func (c *insertCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictOr(
+		complete.PredictFiles("*.tf"),
+		complete.PredictFiles("*.tfvars"),
+		predictYAMLPaths,
+	)
+}
+
+func (c *insertCommand) AutocompleteFlags() complete.Flags {
+	flags := complete.Flags{}
+	for _, name := range []string{"-null", "-template", "-encode", "-flow-width", "-preserve-style", "-verify"} {
+		flags[name] = c.flags.autocompleteFlags()[name]
+	}
+	return flags
+}
+
+func (c *insertCommand) Run(args []string) int {
+	fs := c.meta.flagSet("insert", c)
+	c.flags = convertFlags{aliases: "expand", documents: "tuple", target: "expr"}
+	fs.StringVar(&c.flags.nulls, "null", "null", "")
+	fs.StringVar(&c.flags.template, "template", "literal", "")
+	fs.StringVar(&c.flags.encode, "encode", "none", "")
+	fs.IntVar(&c.flags.flowWidth, "flow-width", 0, "")
+	fs.BoolVar(&c.flags.preserve, "preserve-style", false, "")
+	fs.BoolVar(&c.flags.verify, "verify", false, "")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		c.meta.errorf("insert needs a Terraform file, an address and optionally a YAML file; got %d arguments", fs.NArg())
+		return exitUsage
+	}
+	opts, err := c.flags.options()
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitUsage
+	}
+
+	tfPath, addr := fs.Arg(0), fs.Arg(1)
+	tf, err := os.ReadFile(tfPath)
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+	var yb []byte
+	if fs.NArg() == 3 {
+		opts.Filename = fs.Arg(2)
+		yb, err = os.ReadFile(opts.Filename)
+	} else {
+		yb, err = io.ReadAll(c.meta.Stdin)
+	}
+	if err != nil {
+		c.meta.errorf("reading input: %s", err)
+		return exitError
+	}
+	out, diags := convert.New(opts).Insert(tf, tfPath, addr, yb)
+	printDiagnostics(c.meta.Stderr, diags, map[string][]byte{tfPath: tf, opts.Filename: yb})
+	if diags.HasErrors() {
+		return exitError
+	}
+	if out == nil {
+		return exitOK
+	}
+	if err := os.WriteFile(tfPath, out, 0o644); err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+	return exitOK
+}
+
+type migrateCommand struct {
+	meta  *meta
+	flags convertFlags
+}
+
+func (c *migrateCommand) Synopsis() string {
+	return "Inline the YAML files that Terraform reads with yamldecode or templatefile"
+}
+
+func (c *migrateCommand) Help() string {
+	return `
+Usage: yaml2tf migrate [options] [PATH...]
+
+  Finds calls in Terraform files that read YAML, and replaces each one with
+  the YAML converted into Terraform:
+
+    yamldecode(file("${path.module}/x.yaml"))
+    yamldecode(templatefile("x.yaml.tpl", { ... }))
+    templatefile("x.yaml.tpl", { ... })
+
+  The path must be a literal, optionally starting with ${path.module}, and
+  is taken relative to the Terraform file. Template variables are
+  substituted in as the expressions they're given as. A templatefile call
+  on its own gives a string, so its value is wrapped in yamlencode, or in a
+  "#cloud-config" string if the YAML starts with that header.
+
+  A diff of each file that changes is printed before it's written.
+
+  PATH may be files or directories, and defaults to the current directory.
+  Directories are only searched recursively with -recursive.
+
+Options:
+
+  -write=false        Only print the diffs, without writing to files.
+
+  -recursive          Also process files in subdirectories.
+
+  -null=MODE          How to convert YAML nulls: null (the default), omit to
+                      drop map entries, or empty-string, empty-list or
+                      empty-map to substitute an empty value.
+
+  -flow-width=N       Wrap YAML flow collections whose line would be wider
+                      than N characters.
+
+  -preserve-style     Record how each YAML string was quoted.
+
+  -verify             Check that the Terraform evaluates to the same values
+                      that Terraform's yamldecode gives for each file read
+                      with file.
+`
+}
+
+func (c *migrateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictOr(
+		complete.PredictFiles("*.tf"),
+		complete.PredictDirs("*"),
+	)
+}
+
+func (c *migrateCommand) AutocompleteFlags() complete.Flags {
+	flags := complete.Flags{
+		"-write":     complete.PredictSet("true", "false"),
+		"-recursive": complete.PredictNothing,
+	}
+	for _, name := range []string{"-null", "-flow-width", "-preserve-style", "-verify"} {
+		flags[name] = c.flags.autocompleteFlags()[name]
+	}
+	return flags
+}
+
+func (c *migrateCommand) Run(args []string) int {
+	fs := c.meta.flagSet("migrate", c)
+	c.flags = convertFlags{aliases: "expand", documents: "tuple", template: "literal", target: "expr", encode: "none"}
+	write := fs.Bool("write", true, "")
+	recursive := fs.Bool("recursive", false, "")
+	fs.StringVar(&c.flags.nulls, "null", "null", "")
+	fs.IntVar(&c.flags.flowWidth, "flow-width", 0, "")
+	fs.BoolVar(&c.flags.preserve, "preserve-style", false, "")
+	fs.BoolVar(&c.flags.verify, "verify", false, "")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	opts, err := c.flags.options()
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitUsage
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findFiles(paths, *recursive, ".tf")
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+
+	conv := convert.New(opts)
+	ok := true
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			c.meta.errorf("%s", err)
+			ok = false
+			continue
+		}
+		out, diags := conv.Migrate(src, path)
+		printDiagnostics(c.meta.Stderr, diags, diagnosticSources(diags, map[string][]byte{path: src}))
+		if diags.HasErrors() {
+			ok = false
+			continue
+		}
+		if bytes.Equal(src, out) {
+			continue
+		}
+		d, err := terraformfmt.BytesDiff(src, out, path)
+		if err != nil {
+			c.meta.errorf("diffing %s: %s", path, err)
+			ok = false
+			continue
+		}
+		c.meta.Stdout.Write(d)
+		if *write {
+			if err := os.WriteFile(path, out, 0o644); err != nil {
+				c.meta.errorf("%s", err)
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		return exitError
+	}
+	return exitOK
+}
+
+type versionCommand struct {
+	meta *meta
+}
+
+func (c *versionCommand) Synopsis() string {
+	return "Show the current yaml2tf version"
+}
+
+func (c *versionCommand) Help() string {
+	return `
+Usage: yaml2tf version
+
+  Displays the version of yaml2tf.
+`
+}
+
+func (c *versionCommand) Run(args []string) int {
+	fmt.Fprintf(c.meta.Stdout, "yaml2tf v%s\n", version)
+	return exitOK
+}
+
+type helpCommand struct {
+	meta     *meta
+	commands map[string]cli.CommandFactory
+	helpFunc cli.HelpFunc
+}
+
+func (c *helpCommand) Synopsis() string {
+	return "Show help for yaml2tf or one of its commands"
+}
+
+func (c *helpCommand) Help() string {
+	return `
+Usage: yaml2tf help [COMMAND]
+
+  Shows the help for COMMAND, or lists all the commands.
+`
+}
+
+func (c *helpCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictSet(mapKeys(c.commands)...)
+}
+
+func (c *helpCommand) AutocompleteFlags() complete.Flags {
+	return nil
+}
+
+func (c *helpCommand) Run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(c.meta.Stdout, c.helpFunc(c.commands))
+		return exitOK
+	}
+	factory, ok := c.commands[args[0]]
+	if !ok {
+		c.meta.errorf("unknown command %q", args[0])
+		fmt.Fprintln(c.meta.Stderr, c.helpFunc(c.commands))
+		return exitUsage
+	}
+	cmd, err := factory()
+	if err != nil {
+		c.meta.errorf("%s", err)
+		return exitError
+	}
+	fmt.Fprintln(c.meta.Stdout, strings.TrimSpace(cmd.Help()))
+	return exitOK
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	m := &meta{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: out,
+		Stderr: errOut,
+	}
+	code = m.run(args)
+	return code, out.String(), errOut.String()
+}
+
+func TestCommand_convertStdin(t *testing.T) {
+	code, stdout, stderr := runCommand(t, "a: ~\nb: 1\n", "convert", "-null=omit")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "{\n  b = 1,\n}\n", stdout)
+
+	code, _, stderr = runCommand(t, "a: [\n", "convert")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "Invalid YAML")
+
+	code, _, stderr = runCommand(t, "", "convert", "-null=nope")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `invalid null mode "nope"`)
+}
+
+func TestCommand_convertTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cloud-init.yaml": "a: 1\n"})
+	code, _, stderr := runCommand(t, "", "convert", "-target=tfvars", dir)
+	assert.Equal(t, exitOK, code, stderr)
+	b, err := os.ReadFile(filepath.Join(dir, "cloud-init.tfvars"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "cloud_init = {\n")
+
+	code, stdout, stderr := runCommand(t, "a: 1\n", "convert", "-target=output")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "output \"value\" {\n  value = {\n    a = 1,\n  }\n}\n", stdout)
+
+	code, _, stderr = runCommand(t, "", "convert", "-target=variable", "-aliases=locals")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "can't use -target=variable with -aliases=locals")
+
+	code, _, stderr = runCommand(t, "", "convert", "-target=tfvars", "-encode=jsonencode")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "can't use -encode=jsonencode with -target=tfvars")
+
+	code, _, stderr = runCommand(t, "", "convert", "-target=kubernetes_manifest", "-name=app")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "can't use -name with kubernetes_manifest")
+}
+
+func TestCommand_convertVerify(t *testing.T) {
+	code, _, stderr := runCommand(t, "a: 1\n", "convert", "-verify")
+	assert.Equal(t, exitOK, code, stderr)
+
+	code, stdout, stderr := runCommand(t, "a: [n]\n", "convert", "-verify")
+	assert.Equal(t, exitError, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "At .a[0], YAML has the bool false")
+
+	code, _, stderr = runCommand(t, "", "convert", "-verify", "-template=template")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "can't use -verify with -template=template")
+}
+
+func TestCommand_tf2yaml(t *testing.T) {
+	code, stdout, stderr := runCommand(t, "{\n  a = 1, # one\n}\n", "tf2yaml")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "a: 1 # one\n", stdout)
+
+	code, _, stderr = runCommand(t, "{\n  a = var.x,\n}\n", "tf2yaml")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "Unsupported expression")
+}
+
+func TestCommand_insert(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.tf")
+	writeFiles(t, dir, map[string]string{
+		"main.tf":   "resource \"aws_instance\" \"web\" {\n  ami       = \"ami-123\"\n  user_data = file(\"init.yaml\")\n}\n",
+		"init.yaml": "runcmd: [ls]\n",
+	})
+	code, _, stderr := runCommand(t, "", "insert", "-encode=cloud-config", path, "resource.aws_instance.web.user_data", filepath.Join(dir, "init.yaml"))
+	assert.Equal(t, exitOK, code, stderr)
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "resource \"aws_instance\" \"web\" {\n  ami       = \"ami-123\"\n  user_data = \"#cloud-config\\n${yamlencode({\n    runcmd = [\"ls\"],\n  })}\"\n}\n", string(got))
+
+	code, _, stderr = runCommand(t, "a: 1\n", "insert", path, "resource.aws_instance.db.user_data")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "Block not found")
+
+	code, _, stderr = runCommand(t, "", "insert", path)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "insert needs a Terraform file")
+}
+
+func TestCommand_migrate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.tf")
+	writeFiles(t, dir, map[string]string{
+		"main.tf":     "locals {\n  config = yamldecode(file(\"${path.module}/config.yaml\"))\n}\n",
+		"config.yaml": "a: 1\n",
+	})
+
+	code, stdout, stderr := runCommand(t, "", "migrate", "-write=false", dir)
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "-  config = yamldecode(file(\"${path.module}/config.yaml\"))\n")
+	assert.Contains(t, stdout, "+  config = {\n")
+
+	code, _, stderr = runCommand(t, "", "migrate", dir)
+	assert.Equal(t, exitOK, code, stderr)
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "locals {\n  config = {\n    a = 1,\n  }\n}\n", string(got))
+
+	code, stdout, _ = runCommand(t, "", "migrate", dir)
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stdout)
+
+	writeFiles(t, dir, map[string]string{"main.tf": "a = yamldecode(file(\"bad.yaml\"))\n", "bad.yaml": "a: [\n"})
+	code, _, stderr = runCommand(t, "", "migrate", dir)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "Invalid YAML")
+}
+
+func TestCommand_unknown(t *testing.T) {
+	code, _, stderr := runCommand(t, "", "nope")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Available commands are:")
+}
+
+func TestCommand_help(t *testing.T) {
+	code, stdout, _ := runCommand(t, "", "help", "convert")
+	assert.Equal(t, exitOK, code)
+	assert.True(t, strings.HasPrefix(stdout, "Usage: yaml2tf convert"), stdout)
+}
+
+func TestCommand_version(t *testing.T) {
+	code, stdout, _ := runCommand(t, "", "version")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "yaml2tf v"+version+"\n", stdout)
+}
+
+func TestCommand_convertAndCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.yaml": "a: 1\n"})
+
+	code, stdout, _ := runCommand(t, "", "check", dir)
+	assert.Equal(t, exitChanged, code)
+	assert.Equal(t, filepath.Join(dir, "a.tf")+"\n", stdout)
+
+	// A bare value isn't valid Terraform, so files get locals.
+	code, _, stderr := runCommand(t, "", "convert", "-target=expr", dir)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "can't use -target=expr with paths")
+
+	code, _, stderr = runCommand(t, "", "convert", dir)
+	assert.Equal(t, exitOK, code, stderr)
+	got, err := os.ReadFile(filepath.Join(dir, "a.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(got), "locals {\n  a = {\n    a = 1,\n  }\n}\n")
+	code, stdout, _ = runCommand(t, "", "check", dir)
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stdout)
+
+	writeFiles(t, dir, map[string]string{"a.yaml": "a: 2\n"})
+	code, _, _ = runCommand(t, "", "check", dir)
+	assert.Equal(t, exitChanged, code)
+}
+
+func TestCommand_convertDocumentsLocalsFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.yaml": "a: 1\n---\nb: 2\n", "b.yaml": "c: 3\n---\nd: 4\n"})
+
+	// Each file's documents are named after it, so the locals don't clash.
+	code, _, stderr := runCommand(t, "", "convert", "-documents=locals", dir)
+	assert.Equal(t, exitOK, code, stderr)
+	a, err := os.ReadFile(filepath.Join(dir, "a.tf"))
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(dir, "b.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(a), "  a_0 = {")
+	assert.Contains(t, string(a), "  a_1 = {")
+	assert.Contains(t, string(b), "  b_0 = {")
+	assert.Contains(t, string(b), "  b_1 = {")
+}
+
+func TestCommand_fmt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.tf")
+	writeFiles(t, dir, map[string]string{"main.tf": "locals {\nfoo=1\n}\n"})
+
+	code, stdout, _ := runCommand(t, "", "fmt", "-check", dir)
+	assert.Equal(t, exitChanged, code)
+	assert.Equal(t, path+"\n", stdout)
+
+	code, _, stderr := runCommand(t, "", "fmt", dir)
+	assert.Equal(t, exitOK, code, stderr)
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "locals {\n  foo = 1\n}\n", string(got))
+
+	code, _, _ = runCommand(t, "", "fmt", "-check", dir)
+	assert.Equal(t, exitOK, code)
+}
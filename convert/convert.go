@@ -0,0 +1,1769 @@
+// Package convert converts YAML into Terraform, keeping its comments, key
+// order and scalar styles, and converts Terraform values back into YAML.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/nfi-hashicorp/yaml2tf/terraformfmt"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// NullMode controls how YAML null values are converted.
+type NullMode int
+
+const (
+	// NullKeyword emits the Terraform null keyword.
+	NullKeyword NullMode = iota
+	// NullOmit drops map entries whose value is null entirely. Terraform
+	// treats an absent attribute differently from a null one in some places,
+	// e.g. optional object type attributes.
+	//
+	// Nulls in sequences are still emitted as null, since dropping them would
+	// shift the index of every later element.
+	NullOmit
+	// NullEmptyString, NullEmptyTuple and NullEmptyObject substitute a typed
+	// empty value for every null.
+	NullEmptyString
+	NullEmptyTuple
+	NullEmptyObject
+)
+
+// NullModes maps the names of the -null flag's values to their NullMode.
+var NullModes = map[string]NullMode{
+	"null":         NullKeyword,
+	"omit":         NullOmit,
+	"empty-string": NullEmptyString,
+	"empty-list":   NullEmptyTuple,
+	"empty-map":    NullEmptyObject,
+}
+
+// ParseNullMode returns the NullMode called s in NullModes, or an error
+// listing the valid names.
+func ParseNullMode(s string) (NullMode, error) {
+	m, ok := NullModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid null mode %q; must be one of null, omit, empty-string, empty-list, empty-map", s)
+	}
+	return m, nil
+}
+
+// AliasMode controls how YAML aliases (`*name`) are converted.
+type AliasMode int
+
+const (
+	// AliasExpand converts a copy of the anchored node in place of each alias.
+	AliasExpand AliasMode = iota
+	// AliasLocals hoists each anchored node that has aliases into a local
+	// value named after the anchor, and references it as local.<name> both
+	// where it was anchored and from every alias.
+	AliasLocals
+)
+
+// AliasModes maps the names of the -aliases flag's values to their AliasMode.
+var AliasModes = map[string]AliasMode{
+	"expand": AliasExpand,
+	"locals": AliasLocals,
+}
+
+// ParseAliasMode returns the AliasMode called s in AliasModes, or an error
+// listing the valid names.
+func ParseAliasMode(s string) (AliasMode, error) {
+	m, ok := AliasModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid alias mode %q; must be one of expand, locals", s)
+	}
+	return m, nil
+}
+
+// DocumentsMode controls how a stream of several YAML documents is converted.
+type DocumentsMode int
+
+const (
+	// DocumentsTuple converts the stream into a single tuple with one element
+	// per document. A stream with only one document converts to just its value.
+	DocumentsTuple DocumentsMode = iota
+	// DocumentsLocals converts each document into a local value named
+	// <name>_<index>, after Options.Name, so that the locals converted from
+	// different files don't clash.
+	DocumentsLocals
+	// DocumentsKubernetesManifest converts each document into the manifest of
+	// its own kubernetes_manifest resource, the same as
+	// TargetKubernetesManifest.
+	DocumentsKubernetesManifest
+)
+
+// DocumentsModes maps the names of the -documents flag's values to their
+// DocumentsMode.
+var DocumentsModes = map[string]DocumentsMode{
+	"tuple":               DocumentsTuple,
+	"locals":              DocumentsLocals,
+	"kubernetes_manifest": DocumentsKubernetesManifest,
+}
+
+// ParseDocumentsMode returns the DocumentsMode called s in DocumentsModes, or
+// an error listing the valid names.
+func ParseDocumentsMode(s string) (DocumentsMode, error) {
+	m, ok := DocumentsModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid documents mode %q; must be one of tuple, locals, kubernetes_manifest", s)
+	}
+	return m, nil
+}
+
+// TemplateMode controls what happens to text in YAML strings that Terraform
+// would read as a template sequence: an interpolation (`${...}`) or a
+// directive (`%{...}`).
+type TemplateMode int
+
+const (
+	// TemplateLiteral escapes template sequences, so that Terraform produces
+	// the text exactly as it was in YAML.
+	TemplateLiteral TemplateMode = iota
+	// TemplateLive keeps template sequences as they are, so that they work
+	// as Terraform interpolations and directives.
+	TemplateLive
+	// TemplateFile treats the YAML as a source for Terraform's templatefile:
+	// template sequences are kept, strings that are just one interpolation
+	// become bare expressions, and directives on lines of their own around
+	// list items become for expressions and conditionals.
+	TemplateFile
+)
+
+// TemplateModes maps the names of the -template flag's values to their
+// TemplateMode.
+var TemplateModes = map[string]TemplateMode{
+	"literal":      TemplateLiteral,
+	"template":     TemplateLive,
+	"templatefile": TemplateFile,
+}
+
+// ParseTemplateMode returns the TemplateMode called s in TemplateModes, or an
+// error listing the valid names.
+func ParseTemplateMode(s string) (TemplateMode, error) {
+	m, ok := TemplateModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid template mode %q; must be one of literal, template, templatefile", s)
+	}
+	return m, nil
+}
+
+// TargetMode controls the shape of the Terraform that the converted value is
+// wrapped in.
+type TargetMode int
+
+const (
+	// TargetExpr emits the bare value, for pasting into some other
+	// configuration.
+	TargetExpr TargetMode = iota
+	// TargetLocals emits locals { <name> = ... }.
+	TargetLocals
+	// TargetVariable emits variable "<name>" { default = ... }.
+	TargetVariable
+	// TargetOutput emits output "<name>" { value = ... }.
+	TargetOutput
+	// TargetTFVars emits <name> = ..., for a .tfvars file.
+	TargetTFVars
+	// TargetKubernetesManifest emits a kubernetes_manifest resource for each
+	// document, named after the manifest's kind, namespace and name.
+	TargetKubernetesManifest
+)
+
+// TargetModes maps the names of the -target flag's values to their
+// TargetMode.
+var TargetModes = map[string]TargetMode{
+	"expr":     TargetExpr,
+	"locals":   TargetLocals,
+	"variable": TargetVariable,
+	"output":   TargetOutput,
+	"tfvars":   TargetTFVars,
+
+	"kubernetes_manifest": TargetKubernetesManifest,
+}
+
+// ParseTargetMode returns the TargetMode called s in TargetModes, or an error
+// listing the valid names.
+func ParseTargetMode(s string) (TargetMode, error) {
+	m, ok := TargetModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid target %q; must be one of expr, locals, variable, output, tfvars, kubernetes_manifest", s)
+	}
+	return m, nil
+}
+
+// Constant reports whether the target only allows constant values: no
+// function calls, and no references.
+func (m TargetMode) Constant() bool {
+	return m == TargetVariable || m == TargetTFVars
+}
+
+// defaultName derives a name for the converted value from the YAML file's
+// name, as an identifier: config/cloud-init.yaml gives cloud_init.
+func defaultName(filename string) string {
+	base := filepath.Base(filename)
+	return sanitizeIdentifier(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// manifestName derives a resource name for the Kubernetes manifest in document
+// d, as <kind>_<namespace>_<name>, or <kind>_<name> for one that isn't
+// namespaced. It returns "" if d doesn't look like a manifest.
+func manifestName(d *yaml.Node) string {
+	kind := mappingValue(d, "kind")
+	metadata := mappingValue(d, "metadata")
+	name := mappingValue(metadata, "name")
+	if kind == nil || kind.Kind != yaml.ScalarNode || kind.Value == "" || name == nil || name.Kind != yaml.ScalarNode || name.Value == "" {
+		return ""
+	}
+	parts := []string{kind.Value, name.Value}
+	if ns := mappingValue(metadata, "namespace"); ns != nil && ns.Kind == yaml.ScalarNode && ns.Value != "" {
+		parts = []string{kind.Value, ns.Value, name.Value}
+	}
+	return sanitizeIdentifier(strings.ToLower(strings.Join(parts, "_")))
+}
+
+// mappingValue returns the value for key in the mapping y, looking through
+// documents and aliases, or nil if there isn't one.
+func mappingValue(y *yaml.Node, key string) *yaml.Node {
+	for y != nil && (y.Kind == yaml.DocumentNode || y.Kind == yaml.AliasNode) {
+		if y.Kind == yaml.AliasNode {
+			y = y.Alias
+		} else if len(y.Content) > 0 {
+			y = y.Content[0]
+		} else {
+			return nil
+		}
+	}
+	if y == nil || y.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(y.Content); i += 2 {
+		if y.Content[i].Value == key {
+			v := y.Content[i+1]
+			if v.Kind == yaml.AliasNode {
+				v = v.Alias
+			}
+			return v
+		}
+	}
+	return nil
+}
+
+// manifestNames names the kubernetes_manifest resource for each document,
+// falling back to <name>_<index>, and numbering any repeats so that every
+// name is unique.
+func manifestNames(docs []*yaml.Node, fallback string) []string {
+	names := make([]string, len(docs))
+	seen := map[string]int{}
+	for i, d := range docs {
+		name := manifestName(d)
+		if name == "" {
+			name = documentName(fallback, i)
+		}
+		seen[name]++
+		for n := seen[name]; n > 1; n++ {
+			numbered := fmt.Sprintf("%s_%d", name, n)
+			if seen[numbered] == 0 {
+				name = numbered
+				seen[numbered]++
+				break
+			}
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// EncodeMode controls whether the converted value is wrapped in a call that
+// encodes it back into a string, ready to pass to whatever consumes it.
+type EncodeMode int
+
+const (
+	// EncodeNone leaves the value as it is.
+	EncodeNone EncodeMode = iota
+	// EncodeYAML wraps the value in yamlencode().
+	EncodeYAML
+	// EncodeJSON wraps the value in jsonencode().
+	EncodeJSON
+	// EncodeCloudConfig wraps the value in yamlencode(), after the
+	// #cloud-config line that cloud-init needs to see first in user data.
+	EncodeCloudConfig
+)
+
+// EncodeModes maps the names of the -encode flag's values to their
+// EncodeMode.
+var EncodeModes = map[string]EncodeMode{
+	"none":         EncodeNone,
+	"yamlencode":   EncodeYAML,
+	"jsonencode":   EncodeJSON,
+	"cloud-config": EncodeCloudConfig,
+}
+
+// ParseEncodeMode returns the EncodeMode called s in EncodeModes, or an error
+// listing the valid names.
+func ParseEncodeMode(s string) (EncodeMode, error) {
+	m, ok := EncodeModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid encoding %q; must be one of none, yamlencode, jsonencode, cloud-config", s)
+	}
+	return m, nil
+}
+
+// encodeTokens wraps the tokens of a value according to the EncodeMode.
+func (m EncodeMode) encodeTokens(value []*hclwrite.Token) []*hclwrite.Token {
+	if m == EncodeNone {
+		return value
+	}
+	fn := "yamlencode"
+	if m == EncodeJSON {
+		fn = "jsonencode"
+	}
+	toks := []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte(fn),
+		},
+		{
+			Type:  hclsyntax.TokenOParen,
+			Bytes: []byte{'('},
+		},
+	}
+	toks = append(toks, value...)
+	if endsWithHeredoc(toks) {
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenNewline,
+			Bytes: []byte{'\n'},
+		})
+	}
+	toks = append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenCParen,
+		Bytes: []byte{')'},
+	})
+	if m != EncodeCloudConfig {
+		return toks
+	}
+
+	cloudConfig := []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenOQuote,
+			Bytes: []byte{'"'},
+		},
+		{
+			Type:  hclsyntax.TokenQuotedLit,
+			Bytes: escapeQuotedStringLit("#cloud-config\n", false),
+		},
+		{
+			Type:  hclsyntax.TokenTemplateInterp,
+			Bytes: []byte("${"),
+		},
+	}
+	cloudConfig = append(cloudConfig, toks...)
+	return append(cloudConfig,
+		&hclwrite.Token{
+			Type:  hclsyntax.TokenTemplateSeqEnd,
+			Bytes: []byte{'}'},
+		},
+		&hclwrite.Token{
+			Type:  hclsyntax.TokenCQuote,
+			Bytes: []byte{'"'},
+		},
+	)
+}
+
+// Options controls how YAML is converted. The zero value gives the
+// default behavior.
+type Options struct {
+	Nulls     NullMode
+	Aliases   AliasMode
+	Documents DocumentsMode
+	Templates TemplateMode
+	// Target is what to wrap the value in, and Name is the name to give it
+	// there. Name defaults to one based on Filename. Only a single value,
+	// as DocumentsTuple gives, can be wrapped.
+	Target TargetMode
+	Name   string
+	// Encode wraps the value, inside any Target, in a call to encode it.
+	Encode EncodeMode
+	// PreserveStyle records how each string was quoted in YAML, so that
+	// converting back to YAML can quote it the same way again.
+	PreserveStyle bool
+	// Verify checks that the Terraform evaluates to the same values that
+	// Terraform's yamldecode gives for the YAML, reporting any difference as
+	// an error.
+	Verify bool
+	// FlowWidth is the widest a line holding a YAML flow collection may be,
+	// in characters, counting its indentation, key and trailing comma, for
+	// the collection to be converted into a literal on one line. Zero means
+	// no limit.
+	FlowWidth int
+
+	// Filename is the name of the YAML file, used in diagnostics.
+	Filename string
+	// Source is the YAML the nodes were parsed from, if available. It lets
+	// diagnostics point at a byte range, so they can show a source snippet.
+	Source []byte
+}
+
+// valueName is the name that the Target gives the value.
+func (o Options) valueName() string {
+	if o.Name == "" {
+		return defaultName(o.Filename)
+	}
+	return o.Name
+}
+
+// documentName names the value converted from the document at index i of a
+// stream when each document gets a name of its own.
+func documentName(name string, i int) string {
+	return fmt.Sprintf("%s_%d", name, i)
+}
+
+type conversion struct {
+	opts Options
+
+	// lines is opts.Source split into lines, for finding blank lines.
+	lines [][]byte
+
+	// depth is the number of brackets enclosing the value being converted,
+	// used to indent heredoc content, which the formatter leaves alone.
+	depth int
+	// lead and trail are the widths of what goes before and after the value
+	// being converted on its line: its indentation, key and equals sign, and
+	// its comma. Flow collections are measured with them against FlowWidth.
+	lead, trail int
+
+	// aliased is the set of nodes that are the target of some alias.
+	aliased map[*yaml.Node]bool
+	// hoisted lists the anchored nodes referenced as locals, which are named
+	// by localNames and converted into localTokens. hoisting is the one
+	// currently being converted.
+	hoisted     []*yaml.Node
+	hoisting    *yaml.Node
+	localNames  map[*yaml.Node]string
+	localTaken  map[string]bool
+	localTokens map[*yaml.Node][]*hclwrite.Token
+	// recursive is the set of aliases that refer to their own ancestors.
+	recursive map[*yaml.Node]bool
+	// templateBlocks are the template directives around the items of each
+	// sequence, in the templatefile mode.
+	templateBlocks map[*yaml.Node][]*templateBlock
+
+	diags hcl.Diagnostics
+	// reported is the diagnostic recorded by reportOnce for each node.
+	reported map[*yaml.Node]*hcl.Diagnostic
+}
+
+func newConversion(opts Options) *conversion {
+	return &conversion{
+		opts:        opts,
+		lines:       bytes.Split(opts.Source, []byte{'\n'}),
+		aliased:     map[*yaml.Node]bool{},
+		localNames:  map[*yaml.Node]string{},
+		localTaken:  map[string]bool{},
+		localTokens: map[*yaml.Node][]*hclwrite.Token{},
+		recursive:   map[*yaml.Node]bool{},
+
+		templateBlocks: map[*yaml.Node][]*templateBlock{},
+		reported:       map[*yaml.Node]*hcl.Diagnostic{},
+	}
+}
+
+// Modeled after hclwrite.TokensForValue, but for YAML.
+//
+// Generally we don't worry about whitespace, and assume the caller will format it.
+// (🖕 YAML with your semantic whitespace!)
+//
+// I couldn't make this work with hclwrite body and block building
+// because those don't give us enough control over ordering and comments.
+func (c *conversion) yamlIntoTFTokens(y *yaml.Node) []*hclwrite.Token {
+	if c.opts.Aliases == AliasLocals && c.aliased[y] && y != c.hoisting {
+		return c.localRefTokens(y)
+	}
+	switch y.Kind {
+	case yaml.DocumentNode:
+		if len(y.Content) == 0 {
+			return c.nullTokens()
+		}
+		// Entries and items have their head comments put in place by the
+		// collection they're in, but the top-level value has no collection.
+		return append(commentTokens(y.Content[0].HeadComment), c.yamlIntoTFTokens(y.Content[0])...)
+	case yaml.MappingNode:
+		if toks := c.flowTokens(y); toks != nil {
+			return toks
+		}
+		merges, content := splitMergeKeys(y)
+		if len(merges) == 0 {
+			return c.objectTokens(content)
+		}
+		if c.opts.Aliases == AliasExpand {
+			return c.objectTokens(c.expandMergeKeys(y))
+		}
+		return c.mergeTokens(merges, content)
+	case yaml.AliasNode:
+		if c.recursive[y] {
+			return c.placeholderTokens()
+		}
+		if c.opts.Aliases == AliasLocals {
+			return c.localRefTokens(y.Alias)
+		}
+		return c.yamlIntoTFTokens(y.Alias)
+	case yaml.SequenceNode:
+		if blocks := c.templateBlocks[y]; len(blocks) > 0 {
+			return c.concatTokens(c.templateSegments(y.Content, blocks, y.Style))
+		}
+		if toks := c.flowTokens(y); toks != nil {
+			return toks
+		}
+		toks := []*hclwrite.Token{
+			{
+				Type:  hclsyntax.TokenOBrack,
+				Bytes: []byte{'['},
+			},
+		}
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenNewline,
+			Bytes: []byte{'\n'},
+		})
+		c.depth++
+		for i, v := range y.Content {
+			if i > 0 && (c.blankLineBetween(y.Content[i-1], v) || y.Content[i-1].FootComment != "" && v.HeadComment != "") {
+				// YAML only tells a foot comment apart from the next
+				// element's head comment by the blank line between them.
+				toks = append(toks, &hclwrite.Token{
+					Type:  hclsyntax.TokenNewline,
+					Bytes: []byte{'\n'},
+				})
+			}
+			toks = append(toks, commentTokens(v.HeadComment)...)
+			c.startValue("", true)
+			toks = append(toks, c.yamlIntoTFTokens(v)...)
+			if endsWithHeredoc(toks) {
+				// Tuple elements need commas, but the closing marker must
+				// be alone on its line, so the comma goes on the next one.
+				toks = append(toks, &hclwrite.Token{
+					Type:  hclsyntax.TokenNewline,
+					Bytes: []byte{'\n'},
+				})
+				if i == len(y.Content)-1 {
+					if v.LineComment != "" {
+						toks = append(toks, lineEndTokens(v.LineComment)...)
+					}
+					toks = append(toks, commentTokens(v.FootComment)...)
+					continue
+				}
+			}
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte{','},
+			})
+			toks = append(toks, lineEndTokens(v.LineComment)...)
+			toks = append(toks, commentTokens(v.FootComment)...)
+		}
+		c.depth--
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenCBrack,
+			Bytes: []byte{']'},
+		})
+		return toks
+	case yaml.ScalarNode:
+		var ctyVal cty.Value
+		switch y.Tag {
+		case "!!str":
+			// yaml.v3 has already decoded escape sequences in double-quoted
+			// strings and doubled quotes in single-quoted ones, so the style
+			// only matters when preserving it.
+			live := c.checkTemplate(y)
+			if y.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && y.Value != "" {
+				return append(c.styleTokens(y), c.heredocTokens(y.Value, live)...)
+			}
+			if live && c.opts.Templates == TemplateFile {
+				return append(c.styleTokens(y), interpolationTokens(y.Value)...)
+			}
+			return append(c.styleTokens(y), stringTokens(y.Value, live)...)
+		case "!!timestamp":
+			// Terraform has no time type, and works with timestamps as
+			// RFC 3339 strings anyway.
+			return append(c.styleTokens(y), stringTokens(y.Value, false)...)
+		case "!!bool":
+			var b bool
+			yaml.Unmarshal([]byte(y.Value), &b)
+			ctyVal = cty.BoolVal(b)
+		case "!!int", "!!float":
+			return c.yamlNumberIntoTFTokens(y)
+		case "!!null":
+			return c.nullTokens()
+		default:
+			c.errorf(y, "Unsupported YAML tag", "Scalars tagged %s have no Terraform equivalent.", y.Tag)
+			return c.placeholderTokens()
+		}
+		return hclwrite.TokensForValue(ctyVal)
+	default:
+		c.errorf(y, "Unsupported YAML node", "Nodes of kind %v have no Terraform equivalent.", y.Kind)
+		return c.placeholderTokens()
+	}
+}
+
+// objectTokens builds an object literal from the key/value pairs in content,
+// as found in a mapping node's Content.
+func (c *conversion) objectTokens(content []*yaml.Node) []*hclwrite.Token {
+	toks := []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenOBrace,
+			Bytes: []byte{'{'},
+		},
+	}
+	if len(content) > 0 {
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenNewline,
+			Bytes: []byte{'\n'},
+		})
+	}
+	c.depth++
+	for i := 0; i < len(content); i += 2 {
+		k, v := content[i], content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			c.errorf(k, "Unsupported map key", "Terraform object keys must be strings, so YAML map keys must be scalars.")
+			continue
+		}
+		if i > 0 && (c.blankLineBetween(content[i-1], k) ||
+			(content[i-2].FootComment != "" || content[i-1].FootComment != "") &&
+				(k.HeadComment != "" || v.HeadComment != "")) {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenNewline,
+				Bytes: []byte{'\n'},
+			})
+		}
+		// A comment between the equals sign and the value would end the
+		// attribute, so comments on the value go above the key.
+		toks = append(toks, commentTokens(k.HeadComment)...)
+		toks = append(toks, commentTokens(v.HeadComment)...)
+		lineComment := joinComments(k.LineComment, v.LineComment)
+		foot := append(commentTokens(k.FootComment), commentTokens(v.FootComment)...)
+		if v.Tag == "!!null" && c.opts.Nulls == NullOmit {
+			toks = append(toks, commentTokens(lineComment)...)
+			toks = append(toks, foot...)
+			continue
+		}
+
+		key := c.keyTokens(k)
+		c.startValue(string(hclwrite.Tokens(key).Bytes()), true)
+		valToks := c.yamlIntoTFTokens(v)
+		if lineComment != "" && endsWithHeredoc(valToks) {
+			// Nothing may follow the closing marker on its line.
+			toks = append(toks, commentTokens(lineComment)...)
+			lineComment = ""
+		}
+		toks = append(toks, key...)
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenEqual,
+			Bytes: []byte{'='},
+		},
+		)
+		if insertLineComment(valToks, lineComment) {
+			lineComment = ""
+		}
+		toks = append(toks, valToks...)
+		if endsWithHeredoc(toks) {
+			// The closing marker must be alone on its line, and object
+			// entries can be separated by newlines alone.
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenNewline,
+				Bytes: []byte{'\n'},
+			})
+		} else {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte{','},
+			})
+			toks = append(toks, lineEndTokens(lineComment)...)
+		}
+		toks = append(toks, foot...)
+	}
+	c.depth--
+	toks = append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenCBrace,
+		Bytes: []byte{'}'},
+	})
+	return toks
+}
+
+// flowTokens converts a flow collection (`[80, 443]` or `{app: web}`) into a
+// literal on one line, as it was written. It returns nil for collections that
+// need more than one line: block collections, ones with comments, heredocs or
+// merge keys, and ones that would make their line wider than FlowWidth.
+func (c *conversion) flowTokens(y *yaml.Node) []*hclwrite.Token {
+	if y.Style&yaml.FlowStyle == 0 || hasNestedComments(y) {
+		return nil
+	}
+	lead, trail := c.lead, c.trail
+	open, close := &hclwrite.Token{
+		Type:  hclsyntax.TokenOBrack,
+		Bytes: []byte{'['},
+	}, &hclwrite.Token{
+		Type:  hclsyntax.TokenCBrack,
+		Bytes: []byte{']'},
+	}
+	step := 1
+	if y.Kind == yaml.MappingNode {
+		if merges, _ := splitMergeKeys(y); len(merges) > 0 {
+			return nil
+		}
+		open.Type, open.Bytes = hclsyntax.TokenOBrace, []byte{'{'}
+		close.Type, close.Bytes = hclsyntax.TokenCBrace, []byte{'}'}
+		step = 2
+	}
+
+	// Anything reported while converting is reported again by the caller
+	// if the collection has to be wrapped after all.
+	ndiags := len(c.diags)
+	toks := []*hclwrite.Token{open}
+	for i := 0; i < len(y.Content); i += step {
+		var entry []*hclwrite.Token
+		if step == 2 {
+			k, v := y.Content[i], y.Content[i+1]
+			if k.Kind != yaml.ScalarNode {
+				c.errorf(k, "Unsupported map key", "Terraform object keys must be strings, so YAML map keys must be scalars.")
+				continue
+			}
+			if v.Tag == "!!null" && c.opts.Nulls == NullOmit {
+				continue
+			}
+			entry = append(c.keyTokens(k), &hclwrite.Token{
+				Type:  hclsyntax.TokenEqual,
+				Bytes: []byte{'='},
+			})
+			entry = append(entry, c.yamlIntoTFTokens(v)...)
+		} else {
+			entry = c.yamlIntoTFTokens(y.Content[i])
+		}
+		if len(toks) > 1 {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte{','},
+			})
+		}
+		toks = append(toks, entry...)
+	}
+	toks = append(toks, close)
+
+	for _, tok := range toks {
+		// A heredoc, from an alias, can't be followed by a comma or bracket
+		// on its closing line.
+		if tok.Type == hclsyntax.TokenOHeredoc {
+			c.diags = c.diags[:ndiags]
+			return nil
+		}
+	}
+	if c.opts.FlowWidth > 0 && lead+len(hclwrite.Format(hclwrite.Tokens(toks).Bytes()))+trail > c.opts.FlowWidth {
+		c.diags = c.diags[:ndiags]
+		return nil
+	}
+	return toks
+}
+
+// startValue records where the next value to be converted goes on its line:
+// after its indentation and key, if it has one, and before a comma if it's an
+// element of a collection.
+func (c *conversion) startValue(key string, comma bool) {
+	c.lead = 2 * c.depth
+	if key != "" {
+		c.lead += len(key) + len(" = ")
+	}
+	c.trail = 0
+	if comma {
+		c.trail = len(",")
+	}
+}
+
+// hasNestedComments reports whether any node within y has a comment, which
+// would need a line of its own.
+func hasNestedComments(y *yaml.Node) bool {
+	for _, n := range y.Content {
+		// Template directives commented out by markTemplateDirectives
+		// don't count, since they won't be emitted.
+		for _, comment := range []string{n.HeadComment, n.LineComment, n.FootComment} {
+			if len(commentTokens(strings.TrimSpace(comment))) > 0 {
+				return true
+			}
+		}
+		if hasNestedComments(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentTokens converts a YAML comment, which may span several lines, into
+// HCL comment tokens, one per line. Blank lines between comment groups are
+// kept so that the formatter leaves them separate.
+func commentTokens(comment string) []*hclwrite.Token {
+	if comment == "" {
+		return nil
+	}
+	toks := []*hclwrite.Token{}
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if isTemplateMarker(line) {
+			continue
+		}
+		if line == "" {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenNewline,
+				Bytes: []byte{'\n'},
+			})
+			continue
+		}
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenComment,
+			Bytes: []byte(line + "\n"),
+		})
+	}
+	return toks
+}
+
+// lineEndTokens ends the current line, carrying over a YAML line comment if
+// there is one. A comment token includes its own newline.
+func lineEndTokens(comment string) []*hclwrite.Token {
+	if comment == "" {
+		return []*hclwrite.Token{{
+			Type:  hclsyntax.TokenNewline,
+			Bytes: []byte{'\n'},
+		}}
+	}
+	return []*hclwrite.Token{{
+		Type:  hclsyntax.TokenComment,
+		Bytes: []byte(strings.TrimSpace(comment) + "\n"),
+	}}
+}
+
+// blankLineBetween reports whether the YAML source has a blank line just
+// above y, or above its head comment, so that groups of entries stay apart.
+// Runs of blank lines come out as one, as terraform fmt would leave them.
+// prev is the node before y, whose kept trailing blank lines (`|+`) are part
+// of its value rather than a gap.
+func (c *conversion) blankLineBetween(prev, y *yaml.Node) bool {
+	if prev.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && strings.HasSuffix(prev.Value, "\n\n") {
+		return false
+	}
+	if y.Line <= prev.Line {
+		// Elements of a flow collection on one line, or keys merged in
+		// from elsewhere.
+		return false
+	}
+	line := y.Line - 1
+	if y.HeadComment != "" {
+		line -= strings.Count(y.HeadComment, "\n") + 1
+	}
+	if line < 1 || line > len(c.lines) {
+		return false
+	}
+	return len(bytes.TrimSpace(c.lines[line-1])) == 0
+}
+
+// joinComments combines the line comments of a key and its value, which
+// end up on the same line in Terraform.
+func joinComments(comments ...string) string {
+	var nonEmpty []string
+	for _, c := range comments {
+		if c != "" {
+			nonEmpty = append(nonEmpty, c)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// insertLineComment puts comment at the end of the first line of a
+// multi-line value, so that it stays next to the key as it was in YAML.
+// It reports false if the value is on one line, or starts with a heredoc,
+// leaving the caller to place the comment.
+func insertLineComment(toks []*hclwrite.Token, comment string) bool {
+	if comment == "" {
+		return false
+	}
+	for i, tok := range toks {
+		switch tok.Type {
+		case hclsyntax.TokenOHeredoc:
+			return false
+		case hclsyntax.TokenNewline:
+			toks[i] = lineEndTokens(comment)[0]
+			return true
+		}
+	}
+	return false
+}
+
+// splitMergeKeys separates the values of any merge keys (`<<: *defaults`) from
+// the rest of a mapping's content. The merged mappings are returned in order of
+// increasing precedence, ready for Terraform's merge(): in YAML, explicit keys
+// win over merged ones, and earlier merged mappings win over later ones.
+func splitMergeKeys(y *yaml.Node) (merges []*yaml.Node, content []*yaml.Node) {
+	for i := 0; i < len(y.Content); i += 2 {
+		k, v := y.Content[i], y.Content[i+1]
+		if k.Tag != "!!merge" {
+			content = append(content, k, v)
+			continue
+		}
+		if v.Kind == yaml.SequenceNode {
+			for j := len(v.Content) - 1; j >= 0; j-- {
+				merges = append(merges, v.Content[j])
+			}
+			continue
+		}
+		merges = append(merges, v)
+	}
+	return merges, content
+}
+
+// expandMergeKeys applies the merge keys in the mapping y statically,
+// returning the key/value pairs of the resulting mapping. y's own keys stay
+// where they are, and the keys merged in go where the merge key was, unless y
+// overrides them. Among the merged mappings, keys from higher precedence ones
+// replace earlier ones, and take their position.
+func (c *conversion) expandMergeKeys(y *yaml.Node) []*yaml.Node {
+	merges, content := splitMergeKeys(y)
+	merged := []*yaml.Node{}
+	for _, m := range merges {
+		if m.Kind == yaml.AliasNode {
+			m = m.Alias
+		}
+		if m.Kind != yaml.MappingNode {
+			c.errorf(m, "Invalid merge key", "The value of a merge key (<<) must be a mapping, an alias to one, or a sequence of those.")
+			continue
+		}
+		pairs := c.expandMergeKeys(m)
+		for i := 0; i < len(pairs); i += 2 {
+			for j := 0; j < len(merged); j += 2 {
+				if merged[j].Value == pairs[i].Value {
+					merged = append(merged[:j], merged[j+2:]...)
+					break
+				}
+			}
+			merged = append(merged, pairs[i], pairs[i+1])
+		}
+	}
+
+	own := map[string]bool{}
+	for i := 0; i < len(content); i += 2 {
+		own[content[i].Value] = true
+	}
+	pairs := []*yaml.Node{}
+	for i := 0; i < len(y.Content); i += 2 {
+		if y.Content[i].Tag != "!!merge" {
+			pairs = append(pairs, y.Content[i], y.Content[i+1])
+			continue
+		}
+		for j := 0; j < len(merged); j += 2 {
+			if !own[merged[j].Value] {
+				pairs = append(pairs, merged[j], merged[j+1])
+			}
+		}
+		// Everything merged is in place at the first merge key.
+		merged = nil
+	}
+	return pairs
+}
+
+// mergeTokens renders a mapping with merge keys as a call to merge(), with the
+// mapping's own entries (if any) last so they take precedence. This keeps the
+// structure of the YAML when aliases are hoisted into locals.
+func (c *conversion) mergeTokens(merges []*yaml.Node, content []*yaml.Node) []*hclwrite.Token {
+	toks := []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte("merge"),
+		},
+		{
+			Type:  hclsyntax.TokenOParen,
+			Bytes: []byte{'('},
+		},
+	}
+	first := true
+	for _, m := range merges {
+		target := m
+		if m.Kind == yaml.AliasNode {
+			target = m.Alias
+		}
+		if target.Kind != yaml.MappingNode {
+			c.errorf(m, "Invalid merge key", "The value of a merge key (<<) must be a mapping, an alias to one, or a sequence of those.")
+			continue
+		}
+		if !first {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte{','},
+			})
+		}
+		c.startValue("", true)
+		toks = append(toks, c.yamlIntoTFTokens(m)...)
+		first = false
+	}
+	if len(content) > 0 {
+		if !first {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte{','},
+			})
+		}
+		toks = append(toks, c.objectTokens(content)...)
+	}
+	return append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenCParen,
+		Bytes: []byte{')'},
+	})
+}
+
+// scanAliases records which nodes are the target of an alias, and rejects
+// aliases to one of their own ancestors, which can't be expanded (or hoisted)
+// without infinite recursion.
+func (c *conversion) scanAliases(y *yaml.Node, ancestors map[*yaml.Node]bool) {
+	if y.Kind == yaml.AliasNode {
+		if ancestors[y.Alias] {
+			c.errorf(y, "Recursive alias", "The alias *%s refers to a node that contains it, which can't be represented in Terraform.", y.Value)
+			c.recursive[y] = true
+			return
+		}
+		c.aliased[y.Alias] = true
+		return
+	}
+	ancestors[y] = true
+	for _, child := range y.Content {
+		c.scanAliases(child, ancestors)
+	}
+	delete(ancestors, y)
+}
+
+// localRefTokens returns a reference to the local value that anchored node y
+// is hoisted into, registering it for hoisting if it hasn't been already.
+func (c *conversion) localRefTokens(y *yaml.Node) []*hclwrite.Token {
+	name, ok := c.localNames[y]
+	if !ok {
+		name = sanitizeIdentifier(y.Anchor)
+		for i := 2; c.localTaken[name]; i++ {
+			name = fmt.Sprintf("%s_%d", sanitizeIdentifier(y.Anchor), i)
+		}
+		c.localTaken[name] = true
+		c.localNames[y] = name
+		c.hoisted = append(c.hoisted, y)
+	}
+	return []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte("local"),
+		},
+		{
+			Type:  hclsyntax.TokenDot,
+			Bytes: []byte{'.'},
+		},
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte(name),
+		},
+	}
+}
+
+// hoistedLocals converts the nodes registered by localRefTokens into local
+// values, in source order. Converting one may register more.
+func (c *conversion) hoistedLocals(body *hclwrite.Body) {
+	for i := 0; i < len(c.hoisted); i++ {
+		y := c.hoisted[i]
+		c.hoisting = y
+		c.depth = 1
+		c.startValue(c.localNames[y], false)
+		c.localTokens[y] = c.yamlIntoTFTokens(y)
+	}
+	c.hoisting = nil
+	c.depth = 0
+
+	sort.SliceStable(c.hoisted, func(i, j int) bool {
+		a, b := c.hoisted[i], c.hoisted[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	for _, y := range c.hoisted {
+		body.SetAttributeRaw(c.localNames[y], c.localTokens[y])
+	}
+}
+
+// sanitizeIdentifier turns an arbitrary name (e.g. a YAML anchor) into an
+// idiomatic HCL identifier by replacing anything but letters, digits and
+// underscores with underscores.
+func sanitizeIdentifier(s string) string {
+	b := strings.Builder{}
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && unicode.IsDigit(r):
+		case i == 0 && unicode.IsDigit(r):
+			b.WriteByte('_')
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// keyTokens returns the tokens for an object key. Plain YAML keys that are valid
+// identifiers are emitted bare, the way people usually write HCL; keys that were
+// quoted in the YAML, or that can't be bare, stay quoted. Non-string keys (e.g.
+// `80: http`) are always quoted, since Terraform object keys are strings anyway.
+func (c *conversion) keyTokens(k *yaml.Node) []*hclwrite.Token {
+	quoted := k.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0
+	if !quoted && k.Tag == "!!str" && isBareKey(k.Value) {
+		return []*hclwrite.Token{
+			{
+				Type:  hclsyntax.TokenIdent,
+				Bytes: []byte(k.Value),
+			},
+		}
+	}
+	live := k.Tag == "!!str" && c.checkTemplate(k)
+	if live && c.opts.Templates == TemplateFile {
+		// Split into template tokens, like values, but kept quoted: a bare
+		// key is a name, not an expression.
+		return append(c.styleTokens(k), lexTokens(`"`+string(escapeQuotedStringLit(k.Value, true))+`"`)...)
+	}
+	return append(c.styleTokens(k), stringTokens(k.Value, live)...)
+}
+
+// stringTokens returns a quoted string literal. Every quoted string goes
+// through here, so that they are all escaped the same way. Template sequences
+// are kept if live is set, and escaped otherwise.
+func stringTokens(s string, live bool) []*hclwrite.Token {
+	return []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenOQuote,
+			Bytes: []byte{'"'},
+		},
+		{
+			Type:  hclsyntax.TokenQuotedLit,
+			Bytes: escapeQuotedStringLit(s, live),
+		},
+		{
+			Type:  hclsyntax.TokenCQuote,
+			Bytes: []byte{'"'},
+		},
+	}
+}
+
+// styleTokens records how a string was written in YAML, as a comment like
+// /* yaml:single */ placed before it, when opts.PreserveStyle is set. Plain
+// and literal strings are what yaml2tf assumes without one.
+func (c *conversion) styleTokens(y *yaml.Node) []*hclwrite.Token {
+	if !c.opts.PreserveStyle {
+		return nil
+	}
+	var style string
+	switch {
+	case y.Style&yaml.SingleQuotedStyle != 0:
+		style = "single"
+	case y.Style&yaml.DoubleQuotedStyle != 0:
+		style = "double"
+	case y.Style&yaml.FoldedStyle != 0:
+		style = "folded"
+	default:
+		return nil
+	}
+	return []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenComment,
+			Bytes: []byte(fmt.Sprintf("/* yaml:%s */", style)),
+		},
+	}
+}
+
+// isBareKey reports whether s can be used as an unquoted object key and still
+// mean the string s. Some keywords parse as something else in key position
+// (e.g. `for` starts a for expression, `null` is the null value).
+func isBareKey(s string) bool {
+	switch s {
+	case "null", "true", "false", "for", "if", "in":
+		return false
+	}
+	return hclsyntax.ValidIdentifier(s)
+}
+
+// heredocTokens renders a block scalar's value as a heredoc. yaml.v3 has
+// already applied folding and chomping, so s is the exact string value.
+//
+// A heredoc always ends with a newline, so values without one (from the strip
+// indicator, `|-`/`>-`) are wrapped in chomp(). Values with extra trailing
+// newlines (`|+`) are just extra empty lines.
+//
+// We prefer an indented <<- heredoc for readability, but since that strips the
+// common leading whitespace, content that is itself indented throughout gets a
+// plain << heredoc instead.
+//
+// Constant values can't call chomp(), so they get a quoted string instead.
+func (c *conversion) heredocTokens(s string, live bool) []*hclwrite.Token {
+	chomped := !strings.HasSuffix(s, "\n")
+	if chomped && c.opts.Target.Constant() {
+		return stringTokens(s, live)
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if chomped {
+		lines[len(lines)-1] += "\n"
+	}
+
+	delim := heredocDelimiter(lines)
+	flush := minIndent(lines) == 0
+	open, indent, closeIndent := "<<"+delim+"\n", "", ""
+	if flush {
+		open = "<<-" + delim + "\n"
+		closeIndent = strings.Repeat("  ", c.depth)
+		indent = closeIndent + "  "
+	}
+
+	toks := []*hclwrite.Token{}
+	if chomped {
+		toks = append(toks,
+			&hclwrite.Token{
+				Type:  hclsyntax.TokenIdent,
+				Bytes: []byte("chomp"),
+			},
+			&hclwrite.Token{
+				Type:  hclsyntax.TokenOParen,
+				Bytes: []byte{'('},
+			},
+		)
+	}
+	toks = append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenOHeredoc,
+		Bytes: []byte(open),
+	})
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			line = indent + line
+		}
+		if live && c.opts.Templates == TemplateFile {
+			toks = append(toks, templateTokens(line)...)
+			continue
+		}
+		if !live {
+			line = escapeTemplateSequences(line)
+		}
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenStringLit,
+			Bytes: []byte(line),
+		})
+	}
+	toks = append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenCHeredoc,
+		Bytes: []byte(closeIndent + delim),
+	})
+	if chomped {
+		toks = append(toks,
+			&hclwrite.Token{
+				Type:  hclsyntax.TokenNewline,
+				Bytes: []byte{'\n'},
+			},
+			&hclwrite.Token{
+				Type:  hclsyntax.TokenCParen,
+				Bytes: []byte{')'},
+			},
+		)
+	}
+	return toks
+}
+
+// heredocDelimiter picks a heredoc delimiter that doesn't appear as a line of
+// its own in the content, which would end the heredoc early.
+func heredocDelimiter(lines []string) string {
+	used := map[string]bool{}
+	for _, line := range lines {
+		used[strings.TrimSpace(line)] = true
+	}
+	for _, delim := range []string{"EOT", "EOF", "END"} {
+		if !used[delim] {
+			return delim
+		}
+	}
+	for i := 1; ; i++ {
+		delim := fmt.Sprintf("EOT%d", i)
+		if !used[delim] {
+			return delim
+		}
+	}
+}
+
+// minIndent returns the smallest number of leading whitespace characters on
+// any line that isn't blank, which is what a <<- heredoc would strip.
+func minIndent(lines []string) int {
+	least := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		if trimmed == "" {
+			continue
+		}
+		n := utf8.RuneCountInString(line[:len(line)-len(trimmed)])
+		if least < 0 || n < least {
+			least = n
+		}
+	}
+	return least
+}
+
+func endsWithHeredoc(toks []*hclwrite.Token) bool {
+	return len(toks) > 0 && toks[len(toks)-1].Type == hclsyntax.TokenCHeredoc
+}
+
+// escapeTemplateSequences doubles up template introducers so that a heredoc
+// produces them literally.
+func escapeTemplateSequences(s string) string {
+	s = strings.ReplaceAll(s, "${", "$${")
+	return strings.ReplaceAll(s, "%{", "%%{")
+}
+
+// templateSequence matches the start of a Terraform template sequence, and as
+// much of the rest of it as fits on the line, for messages.
+var templateSequence = regexp.MustCompile(`[$%]\{[^}\n]*\}?`)
+
+// checkTemplate looks for Terraform template sequences in the string y, and
+// reports whether they should be kept live. Every string that has them gets a
+// warning, since the right answer depends on what the YAML is for: `${HOME}`
+// in a shell script means something else entirely to Terraform.
+func (c *conversion) checkTemplate(y *yaml.Node) bool {
+	seq := templateSequence.FindString(y.Value)
+	if seq == "" {
+		return false
+	}
+	switch c.opts.Templates {
+	case TemplateLiteral:
+		c.reportOnce(y, func() {
+			c.warnf(y, "Template sequence escaped", "This string contains %q, which Terraform would read as a template sequence, so it has been escaped to keep the text as it is. Use -template=template to keep template sequences instead.", seq)
+		})
+		return false
+	}
+	if _, diags := hclsyntax.ParseTemplate([]byte(y.Value), c.opts.Filename, hcl.InitialPos); diags.HasErrors() {
+		c.reportOnce(y, func() {
+			c.errorf(y, "Invalid template", "This string has template sequences that Terraform can't parse: %s", diags[0].Detail)
+		})
+		return false
+	}
+	if c.opts.Templates == TemplateFile {
+		// The whole file is a template, so these are expected.
+		return true
+	}
+	c.reportOnce(y, func() {
+		c.warnf(y, "Template sequence kept", "This string contains %q, which has been kept as a Terraform template sequence. Use -template=literal to escape template sequences instead.", seq)
+	})
+	return true
+}
+
+// nullTokens returns the replacement for a YAML null according to the
+// configured NullMode.
+func (c *conversion) nullTokens() []*hclwrite.Token {
+	switch c.opts.Nulls {
+	case NullEmptyString:
+		return stringTokens("", false)
+	case NullEmptyTuple:
+		return hclwrite.TokensForValue(cty.EmptyTupleVal)
+	case NullEmptyObject:
+		return hclwrite.TokensForValue(cty.EmptyObjectVal)
+	default:
+		return hclwrite.TokensForValue(cty.NullVal(cty.DynamicPseudoType))
+	}
+}
+
+// hclNumberLit matches the YAML number spellings that are also valid HCL
+// number literals with the same value, so we can emit them verbatim.
+// Leading zeros are excluded because YAML reads 0777 as octal.
+var hclNumberLit = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// yamlNumberIntoTFTokens converts an !!int or !!float scalar into a number
+// literal, keeping the YAML spelling if HCL can parse it as-is and falling back
+// to the canonical decimal form otherwise (hex, octal, underscores, etc.).
+//
+// HCL has no literal for infinity, but cty (and so Terraform) can parse one
+// from a string, so we go via tonumber. NaN can't be represented at all.
+func (c *conversion) yamlNumberIntoTFTokens(y *yaml.Node) []*hclwrite.Token {
+	if hclNumberLit.MatchString(y.Value) {
+		return []*hclwrite.Token{
+			{
+				Type:  hclsyntax.TokenNumberLit,
+				Bytes: []byte(y.Value),
+			},
+		}
+	}
+	if y.Tag == "!!float" {
+		switch strings.ToLower(y.Value) {
+		case ".inf", "+.inf", "-.inf":
+			if c.opts.Target.Constant() {
+				c.errorf(y, "Unsupported number", "Terraform can only write infinity as a call to tonumber, which a constant value like a variable default can't have.")
+				return c.placeholderTokens()
+			}
+			if strings.HasPrefix(y.Value, "-") {
+				return tonumberTokens("-inf")
+			}
+			return tonumberTokens("inf")
+		case ".nan":
+			c.errorf(y, "Unsupported number", "Terraform numbers can't be NaN.")
+			return c.placeholderTokens()
+		}
+	}
+	n, err := parseYAMLNumber(y.Tag, y.Value)
+	if err != nil {
+		c.errorf(y, "Invalid number", "Can't parse %q as %s: %s.", y.Value, y.Tag, err)
+		return c.placeholderTokens()
+	}
+	return hclwrite.TokensForValue(n)
+}
+
+// parseYAMLNumber parses the value of a scalar that YAML resolved to !!int or
+// !!float into an exact cty.Number, following the same rules as yaml.v3:
+// underscores are ignored, and ints may have 0x, 0o, 0b or (YAML 1.1) 0 prefixes.
+func parseYAMLNumber(tag, s string) (cty.Value, error) {
+	plain := strings.ReplaceAll(s, "_", "")
+	if tag == "!!int" {
+		i, ok := new(big.Int).SetString(plain, 0)
+		if !ok {
+			return cty.NilVal, fmt.Errorf("not an integer")
+		}
+		return cty.NumberVal(new(big.Float).SetInt(i)), nil
+	}
+	// big.Float doesn't accept a bare leading or trailing dot, but YAML does.
+	sign := ""
+	if plain != "" && (plain[0] == '-' || plain[0] == '+') {
+		sign, plain = plain[:1], plain[1:]
+	}
+	if strings.HasPrefix(plain, ".") {
+		plain = "0" + plain
+	}
+	plain = strings.Replace(plain, ".e", ".0e", 1)
+	plain = strings.Replace(plain, ".E", ".0E", 1)
+	plain = strings.TrimSuffix(plain, ".")
+	return cty.ParseNumberVal(sign + plain)
+}
+
+func tonumberTokens(s string) []*hclwrite.Token {
+	toks := []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte("tonumber"),
+		},
+		{
+			Type:  hclsyntax.TokenOParen,
+			Bytes: []byte{'('},
+		},
+	}
+	toks = append(toks, stringTokens(s, false)...)
+	return append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenCParen,
+		Bytes: []byte{')'},
+	})
+}
+
+// escapeQuotedStringLit escapes s for the inside of a quoted string literal.
+// If live is set, template sequences are kept as they are, and only the text
+// around them is escaped.
+func escapeQuotedStringLit(s string, live bool) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	if !live {
+		return appendEscaped(make([]byte, 0, len(s)), s, true)
+	}
+	toks, _ := hclsyntax.LexTemplate([]byte(s), "", hcl.InitialPos)
+	buf := make([]byte, 0, len(s))
+	pos := 0
+	for _, tok := range toks {
+		end := tok.Range.End.Byte
+		if tok.Type == hclsyntax.TokenStringLit {
+			buf = appendEscaped(buf, s[pos:end], false)
+		} else {
+			buf = append(buf, s[pos:end]...)
+		}
+		pos = end
+	}
+	return buf
+}
+
+// appendEscaped appends s to buf with the escapes a quoted string literal
+// needs, including for template sequences if escapeTemplates is set.
+//
+// yoinked from hclwrite
+func appendEscaped(buf []byte, s string, escapeTemplates bool) []byte {
+	for i, r := range s {
+		switch r {
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '"':
+			buf = append(buf, '\\', '"')
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case '$', '%':
+			buf = appendRune(buf, r)
+			remain := s[i+1:]
+			if escapeTemplates && len(remain) > 0 && remain[0] == '{' {
+				// Double up our template introducer symbol to escape it.
+				buf = appendRune(buf, r)
+			}
+		default:
+			if !unicode.IsPrint(r) {
+				var fmted string
+				if r < 65536 {
+					fmted = fmt.Sprintf("\\u%04x", r)
+				} else {
+					fmted = fmt.Sprintf("\\U%08x", r)
+				}
+				buf = append(buf, fmted...)
+			} else {
+				buf = appendRune(buf, r)
+			}
+		}
+	}
+	return buf
+}
+
+// yoinked from hclwrite
+func appendRune(b []byte, r rune) []byte {
+	l := utf8.RuneLen(r)
+	for i := 0; i < l; i++ {
+		b = append(b, 0) // make room at the end of our buffer
+	}
+	ch := b[len(b)-l:]
+	utf8.EncodeRune(ch, r)
+	return b
+}
+
+func yamlToTF(y *yaml.Node, opts Options) (*hclwrite.File, hcl.Diagnostics) {
+	return yamlDocumentsToTF([]*yaml.Node{y}, opts)
+}
+
+// yamlDocumentsToTF converts every document in a YAML stream, shaped according
+// to opts.Documents. Any problems with the YAML are returned as diagnostics, in
+// which case the file contains null in place of the offending values.
+//
+// A stream with no documents at all (empty, or only comments) converts to an
+// empty file.
+func yamlDocumentsToTF(docs []*yaml.Node, opts Options) (*hclwrite.File, hcl.Diagnostics) {
+	c := newConversion(opts)
+	for _, d := range docs {
+		c.scanAliases(d, map[*yaml.Node]bool{})
+	}
+	if opts.Templates == TemplateFile {
+		c.scanTemplateBlocks(docs)
+	}
+	// Hoisted anchors share the locals block with the converted values, so
+	// they mustn't take their names.
+	k8s := opts.Documents == DocumentsKubernetesManifest || opts.Target == TargetKubernetesManifest
+	switch {
+	case opts.Documents == DocumentsLocals && !k8s:
+		for i := range docs {
+			c.localTaken[documentName(opts.valueName(), i)] = true
+		}
+	case opts.Documents == DocumentsTuple && opts.Target == TargetLocals:
+		c.localTaken[opts.valueName()] = true
+	}
+
+	var value []*hclwrite.Token
+	values := make([][]*hclwrite.Token, len(docs))
+	switch {
+	case len(docs) == 0:
+	case opts.Documents != DocumentsTuple || k8s:
+		for i, d := range docs {
+			c.depth = 1
+			if k8s {
+				c.startValue("manifest", false)
+			} else {
+				c.startValue(documentName(opts.valueName(), i), false)
+			}
+			values[i] = c.yamlIntoTFTokens(d)
+		}
+		c.depth = 0
+	default:
+		if opts.Target == TargetLocals || opts.Target == TargetVariable || opts.Target == TargetOutput {
+			c.depth = 1
+		}
+		switch opts.Target {
+		case TargetLocals, TargetTFVars:
+			c.startValue(opts.valueName(), false)
+		case TargetVariable:
+			c.startValue("default", false)
+		case TargetOutput:
+			c.startValue("value", false)
+		default:
+			c.startValue("", false)
+		}
+		if len(docs) == 1 {
+			value = c.yamlIntoTFTokens(docs[0])
+		} else {
+			value = c.yamlIntoTFTokens(&yaml.Node{
+				Kind:    yaml.SequenceNode,
+				Content: docs,
+			})
+		}
+		c.depth = 0
+	}
+
+	h := hclwrite.NewEmptyFile()
+	body := h.Body()
+	// Several documents carry their comments into the tuple, but a lone
+	// document's comments belong to the file.
+	lone := value != nil && len(docs) == 1
+	if lone && docs[0].HeadComment != "" {
+		body.AppendUnstructuredTokens(commentTokens(docs[0].HeadComment))
+		body.AppendNewline()
+	}
+	var locals *hclwrite.Body
+	if len(c.hoisted) > 0 || opts.Documents == DocumentsLocals || value != nil && opts.Target == TargetLocals {
+		locals = body.AppendNewBlock("locals", nil).Body()
+		c.hoistedLocals(locals)
+		if opts.Documents == DocumentsLocals {
+			for i, d := range docs {
+				locals.AppendUnstructuredTokens(commentTokens(d.HeadComment))
+				locals.SetAttributeRaw(documentName(opts.valueName(), i), values[i])
+				locals.AppendUnstructuredTokens(commentTokens(d.FootComment))
+			}
+		}
+	}
+	if k8s {
+		names := manifestNames(docs, opts.valueName())
+		for i, d := range docs {
+			if d.Kind == yaml.DocumentNode && len(d.Content) > 0 && d.Content[0].Kind != yaml.MappingNode {
+				c.errorf(d.Content[0], "Invalid manifest", "A Kubernetes manifest must be a mapping.")
+			}
+			if len(body.Blocks()) > 0 {
+				body.AppendNewline()
+			}
+			body.AppendUnstructuredTokens(commentTokens(d.HeadComment))
+			r := body.AppendNewBlock("resource", []string{"kubernetes_manifest", names[i]})
+			r.Body().SetAttributeRaw("manifest", values[i])
+			body.AppendUnstructuredTokens(commentTokens(d.FootComment))
+		}
+	}
+	if value != nil {
+		value = opts.Encode.encodeTokens(value)
+		name := opts.valueName()
+		if opts.Target != TargetLocals && len(body.Blocks()) > 0 {
+			body.AppendNewline()
+		}
+		switch opts.Target {
+		case TargetLocals:
+			locals.SetAttributeRaw(name, value)
+		case TargetVariable:
+			body.AppendNewBlock("variable", []string{name}).Body().SetAttributeRaw("default", value)
+		case TargetOutput:
+			body.AppendNewBlock("output", []string{name}).Body().SetAttributeRaw("value", value)
+		case TargetTFVars:
+			body.SetAttributeRaw(name, value)
+		default:
+			body.AppendUnstructuredTokens(value)
+		}
+		if lone && docs[0].FootComment != "" {
+			body.AppendNewline()
+			if opts.Target == TargetExpr {
+				// The bare value has no newline of its own.
+				body.AppendNewline()
+			}
+			body.AppendUnstructuredTokens(commentTokens(docs[0].FootComment))
+		}
+	}
+	terraformfmt.FormatBody(body)
+	return h, c.diags
+}
+
+// convertSource parses and converts the YAML in src, returning the formatted
+// Terraform, or nil if there were errors or nothing to convert.
+func convertSource(src []byte, opts Options) ([]byte, hcl.Diagnostics) {
+	opts.Source = src
+	yamlSrc := src
+	if opts.Templates == TemplateFile {
+		yamlSrc = markTemplateDirectives(src)
+	}
+	docs, diags := parseYAML(yamlSrc, opts.Filename)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	h, convDiags := yamlDocumentsToTF(docs, opts)
+	diags = append(diags, convDiags...)
+	if diags.HasErrors() || len(docs) == 0 {
+		return nil, diags
+	}
+	if opts.Verify {
+		diags = append(diags, verifyYAMLToTF(docs, opts)...)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+	return h.Bytes(), diags
+}
+
+// Converter converts YAML into Terraform according to its Options. It holds
+// no state between conversions, so one Converter can be used for many.
+type Converter struct {
+	opts Options
+}
+
+// New returns a Converter using opts.
+func New(opts Options) *Converter {
+	return &Converter{opts: opts}
+}
+
+// Convert converts a single YAML document, shaped according to the Target and
+// Encode options. Any problems with the YAML are returned as diagnostics, in
+// which case the file contains null in place of the offending values.
+func (c *Converter) Convert(node *yaml.Node) (*hclwrite.File, hcl.Diagnostics) {
+	return yamlToTF(node, c.opts)
+}
+
+// ConvertBytes parses and converts the YAML stream in src, returning the
+// formatted Terraform, or nil if there were errors or nothing to convert.
+// Options.Source is ignored in favor of src.
+func (c *Converter) ConvertBytes(src []byte) ([]byte, hcl.Diagnostics) {
+	return convertSource(src, c.opts)
+}
+
+// ConvertToTokens converts node, a document or any node within one, into the
+// tokens of a single value, ready for hclwrite.Body.SetAttributeRaw. The Target
+// and Documents options don't apply, but Encode does.
+//
+// A value on its own has nowhere to put hoisted locals, so aliases are always
+// expanded.
+func (c *Converter) ConvertToTokens(node *yaml.Node) (hclwrite.Tokens, hcl.Diagnostics) {
+	return convertValue(node, c.opts, 0, 0)
+}
+
+// convertValue converts node into a single value for an attribute nested in
+// depth blocks, which sets how far heredocs are indented, with lead
+// characters before it on its line.
+func convertValue(node *yaml.Node, opts Options, depth, lead int) (hclwrite.Tokens, hcl.Diagnostics) {
+	opts.Aliases = AliasExpand
+	c := newConversion(opts)
+	c.scanAliases(node, map[*yaml.Node]bool{})
+	if opts.Templates == TemplateFile {
+		c.scanTemplateBlocks([]*yaml.Node{node})
+	}
+	c.depth = depth
+	c.lead = lead
+	value := opts.Encode.encodeTokens(c.yamlIntoTFTokens(node))
+	return hclwrite.Tokens(value), c.diags
+}
+
+// Verify checks that the Terraform each of docs converts to evaluates to the
+// same value as Terraform's yamldecode gives for the document, reporting every
+// difference as an error.
+func (c *Converter) Verify(docs []*yaml.Node) hcl.Diagnostics {
+	return verifyYAMLToTF(docs, c.opts)
+}
@@ -0,0 +1,913 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func assertYAMLToTF(t *testing.T, y string, tf string) {
+	t.Helper()
+	assertYAMLToTFOpts(t, Options{}, y, tf)
+}
+
+func assertYAMLToTFOpts(t *testing.T, opts Options, y string, tf string) {
+	t.Helper()
+	yn := yaml.Node{}
+	yaml.Unmarshal([]byte(y), &yn)
+	opts.Source = []byte(y)
+	h, diags := yamlToTF(&yn, opts)
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, tf, string(h.Bytes()))
+}
+
+func TestYAMLToTF_fullyQuotedMap(t *testing.T) {
+	assertYAMLToTF(t, `
+---
+# foo
+"foo": "bar"
+"biz": "boz"
+`, `{
+  # foo
+  "foo" = "bar",
+  "biz" = "boz",
+}`)
+}
+
+func TestYAMLToTF_mixedQuotesMap(t *testing.T) {
+	assertYAMLToTF(t, `
+---
+foo: bar
+"biz": boz
+'baz': buz
+`, `{
+  foo   = "bar",
+  "biz" = "boz",
+  "baz" = "buz",
+}`)
+}
+
+func TestYAMLToTF_nonIdentifierKeys(t *testing.T) {
+	assertYAMLToTF(t, `
+app.kubernetes.io/name: web
+1st: a
+with-dash: b
+under_score: c
+for: d
+80: http
+true: yes
+`, `{
+  "app.kubernetes.io/name" = "web",
+  "1st"                    = "a",
+  with-dash                = "b",
+  under_score              = "c",
+  "for"                    = "d",
+  "80"                     = "http",
+  "true"                   = "yes",
+}`)
+}
+
+func TestYAMLToTF_numbers(t *testing.T) {
+	assertYAMLToTF(t, `
+dec: 42
+neg: -7
+hex: 0x1F
+oct: 0o17
+old_oct: 0777
+bin: 0b101
+under: 1_000_000
+big: 123456789012345678901234567890
+float: 3.14
+exp: 6.02e+23
+plus: +1.5
+lead: .5
+inf: .inf
+ninf: -.Inf
+`, `{
+  dec     = 42,
+  neg     = -7,
+  hex     = 31,
+  oct     = 15,
+  old_oct = 511,
+  bin     = 5,
+  under   = 1000000,
+  big     = 123456789012345678901234567890,
+  float   = 3.14,
+  exp     = 6.02e+23,
+  plus    = 1.5,
+  lead    = 0.5,
+  inf     = tonumber("inf"),
+  ninf    = tonumber("-inf"),
+}`)
+}
+
+func assertYAMLStreamToTF(t *testing.T, opts Options, y string, tf string) {
+	t.Helper()
+	docs := []*yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(y)))
+	for {
+		yn := &yaml.Node{}
+		if err := dec.Decode(yn); err != nil {
+			break
+		}
+		docs = append(docs, yn)
+	}
+	opts.Source = []byte(y)
+	h, diags := yamlDocumentsToTF(docs, opts)
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, tf, string(h.Bytes()))
+}
+
+const nullsYAML = `
+tilde: ~
+word: null
+title: Null
+empty:
+list:
+  - ~
+quoted: "null"
+`
+
+func TestYAMLToTF_nulls(t *testing.T) {
+	assertYAMLToTF(t, nullsYAML, `{
+  tilde = null,
+  word  = null,
+  title = null,
+  empty = null,
+  list = [
+    null,
+  ],
+  quoted = "null",
+}`)
+}
+
+func TestYAMLToTF_nullsOmit(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{Nulls: NullOmit}, nullsYAML, `{
+  list = [
+    null,
+  ],
+  quoted = "null",
+}`)
+}
+
+func TestYAMLToTF_nullsEmpty(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{Nulls: NullEmptyTuple}, nullsYAML, `{
+  tilde = [],
+  word  = [],
+  title = [],
+  empty = [],
+  list = [
+    [],
+  ],
+  quoted = "null",
+}`)
+}
+
+func TestYAMLToTF_blockScalars(t *testing.T) {
+	assertYAMLToTF(t, `
+write_files:
+  - path: /etc/motd
+    content: |
+      Hello ${USER}
+
+      EOT
+runcmd:
+  - |-
+    strip
+  - |+
+    keep
+
+  - >
+    folded
+    text
+  - last
+`, `{
+  write_files = [
+    {
+      path    = "/etc/motd",
+      content = <<-EOF
+        Hello $${USER}
+
+        EOT
+      EOF
+    },
+  ],
+  runcmd = [
+    chomp(<<-EOT
+      strip
+    EOT
+    ),
+    <<-EOT
+      keep
+
+    EOT
+    ,
+    <<-EOT
+      folded text
+    EOT
+    ,
+    "last",
+  ],
+}`)
+}
+
+func TestYAMLToTF_sequenceComments(t *testing.T) {
+	assertYAMLToTF(t, `
+runcmd:
+  # before first
+  - echo one # inline
+  # between
+
+  # second group
+  - name: x
+  - |
+    multi
+  # after last
+`, `{
+  runcmd = [
+    # before first
+    "echo one", # inline
+    # between
+
+    # second group
+    {
+      name = "x",
+    },
+    <<-EOT
+      multi
+    EOT
+    # after last
+  ],
+}`)
+}
+
+func TestYAMLToTF_mappingHeadComments(t *testing.T) {
+	assertYAMLToTF(t, `
+---
+# about the map
+{a: 1}
+`, `# about the map
+{ a = 1 }`)
+	assertYAMLToTF(t, `
+-
+  # about the first
+  {a: 1}
+- 2
+`, `[
+  # about the first
+  { a = 1 },
+  2,
+]`)
+}
+
+func TestYAMLToTF_mappingComments(t *testing.T) {
+	assertYAMLToTF(t, `# top of file
+
+a: 1 # why a
+# foot a
+
+b: # why b
+  c: 2
+  # foot c
+d:
+  # head value
+  value
+e: |  # why e
+  text
+
+# end of file
+`, `# top of file
+
+{
+  a = 1, # why a
+  # foot a
+
+  b = { # why b
+    c = 2,
+    # foot c
+  },
+  # head value
+  d = "value",
+  # why e
+  e = <<-EOT
+    text
+  EOT
+}
+
+# end of file
+`)
+}
+
+func TestYAMLToTF_blankLines(t *testing.T) {
+	assertYAMLToTF(t, `
+name: web
+image: nginx
+
+
+# ports
+ports:
+  - 80
+  - 443
+
+  - 8080
+keep: |+
+  text
+
+after: 1
+`, `{
+  name  = "web",
+  image = "nginx",
+
+  # ports
+  ports = [
+    80,
+    443,
+
+    8080,
+  ],
+  keep  = <<-EOT
+    text
+
+  EOT
+  after = 1,
+}`)
+}
+
+func TestYAMLToTF_flowStyle(t *testing.T) {
+	assertYAMLToTF(t, `
+ports: [80, 443]
+labels: {app: web, tier: "front end"}
+nested: [[1, 2], {a: 1}, []]
+commented: [1, # one
+  2]
+`, `{
+  ports  = [80, 443],
+  labels = { app = "web", tier = "front end" },
+  nested = [[1, 2], { a = 1 }, []],
+  commented = [
+    1, # one
+    2,
+  ],
+}`)
+}
+
+func TestYAMLToTF_flowWidth(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{FlowWidth: 22}, `
+short: [80, 443]
+long: [80, 443, 8080]
+`, `{
+  short = [80, 443],
+  long = [
+    80,
+    443,
+    8080,
+  ],
+}`)
+	// The line's indentation, key and comma count too.
+	assertYAMLToTFOpts(t, Options{FlowWidth: 16}, `
+a: [1, 2]
+outer:
+  nested_key_name: [1, 2]
+`, `{
+  a = [1, 2],
+  outer = {
+    nested_key_name = [
+      1,
+      2,
+    ],
+  },
+}`)
+}
+
+const quotingYAML = `
+plain: hello world
+single: 'it''s'
+double: "tab\there \u00e9 \"q\""
+'key': v
+date: 2001-12-14
+folded: >
+  some
+  text
+`
+
+func TestYAMLToTF_quoting(t *testing.T) {
+	assertYAMLToTF(t, quotingYAML, `{
+  plain  = "hello world",
+  single = "it's",
+  double = "tab\there é \"q\"",
+  "key"  = "v",
+  date   = "2001-12-14",
+  folded = <<-EOT
+    some text
+  EOT
+}`)
+}
+
+func TestYAMLToTF_preserveStyle(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{PreserveStyle: true}, quotingYAML, `{
+  plain                   = "hello world",
+  single                  = /* yaml:single */ "it's",
+  double                  = /* yaml:double */ "tab\there é \"q\"",
+  /* yaml:single */ "key" = "v",
+  date                    = "2001-12-14",
+  folded                  = /* yaml:folded */ <<-EOT
+    some text
+  EOT
+}`)
+}
+
+const templatesYAML = `
+cmd: echo ${HOME} "q"
+expr: ${upper("b")} and $${lit}
+script: |
+  %{ if true }yes%{ endif }
+`
+
+func TestYAMLToTF_templatesLiteral(t *testing.T) {
+	assertYAMLToTF(t, templatesYAML, `{
+  cmd    = "echo $${HOME} \"q\"",
+  expr   = "$${upper(\"b\")} and $$${lit}",
+  script = <<-EOT
+    %%{ if true }yes%%{ endif }
+  EOT
+}`)
+}
+
+func TestYAMLToTF_templatesLive(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{Templates: TemplateLive}, templatesYAML, `{
+  cmd    = "echo ${HOME} \"q\"",
+  expr   = "${upper("b")} and $${lit}",
+  script = <<-EOT
+    %{ if true }yes%{ endif }
+  EOT
+}`)
+}
+
+func TestYAMLToTF_templateDiagnostics(t *testing.T) {
+	src := `
+ok: plain
+home: ${HOME}
+bad: ${
+`
+	for mode, want := range map[TemplateMode][]string{
+		TemplateLiteral: {"3,7: Template sequence escaped", "4,6: Template sequence escaped"},
+		TemplateLive:    {"3,7: Template sequence kept", "4,6: Invalid template"},
+	} {
+		yn := yaml.Node{}
+		yaml.Unmarshal([]byte(src), &yn)
+		_, diags := yamlToTF(&yn, Options{Templates: mode, Source: []byte(src)})
+		summaries := []string{}
+		for _, d := range diags {
+			summaries = append(summaries, fmt.Sprintf("%d,%d: %s", d.Subject.Start.Line, d.Subject.Start.Column, d.Summary))
+		}
+		assert.Equal(t, want, summaries)
+	}
+}
+
+func TestYAMLToTF_templateDiagnosticsAliased(t *testing.T) {
+	src := `
+home: &home ${HOME}
+a: *home
+b: [*home, *home]
+`
+	// Each alias converts the anchored string again, and a wrapped flow
+	// collection converts its elements twice.
+	for _, opts := range []Options{{}, {FlowWidth: 8}, {Aliases: AliasLocals}} {
+		yn := yaml.Node{}
+		yaml.Unmarshal([]byte(src), &yn)
+		opts.Source = []byte(src)
+		_, diags := yamlToTF(&yn, opts)
+		summaries := []string{}
+		for _, d := range diags {
+			summaries = append(summaries, fmt.Sprintf("%d,%d: %s", d.Subject.Start.Line, d.Subject.Start.Column, d.Summary))
+		}
+		assert.Equal(t, []string{"2,7: Template sequence escaped"}, summaries, "%+v", opts)
+	}
+}
+
+func TestYAMLToTF_targets(t *testing.T) {
+	const y = `# head
+
+a: 1
+b: |-
+  x
+`
+	for target, tf := range map[TargetMode]string{
+		TargetLocals: `# head
+
+locals {
+  config = {
+    a = 1,
+    b = chomp(<<-EOT
+      x
+    EOT
+    ),
+  }
+}
+`,
+		TargetVariable: `# head
+
+variable "config" {
+  default = {
+    a = 1,
+    b = "x",
+  }
+}
+`,
+		TargetOutput: `# head
+
+output "config" {
+  value = {
+    a = 1,
+    b = chomp(<<-EOT
+      x
+    EOT
+    ),
+  }
+}
+`,
+		TargetTFVars: `# head
+
+config = {
+  a = 1,
+  b = "x",
+}
+`,
+	} {
+		assertYAMLToTFOpts(t, Options{Target: target, Filename: "dir/config.yaml"}, y, tf)
+	}
+}
+
+func TestYAMLToTF_encode(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{Encode: EncodeJSON}, "a: 1\n", `jsonencode({
+  a = 1,
+})`)
+	assertYAMLToTFOpts(t, Options{Encode: EncodeYAML}, "|\n  x\n", `yamlencode(<<-EOT
+  x
+EOT
+)`)
+	assertYAMLToTFOpts(t, Options{Encode: EncodeCloudConfig, Target: TargetLocals, Name: "user_data"}, `packages:
+  - git # for pulling the repo
+`, `locals {
+  user_data = "#cloud-config\n${yamlencode({
+    packages = [
+      "git", # for pulling the repo
+    ],
+  })}"
+}
+`)
+}
+
+const aliasesYAML = `
+defaults: &defaults
+  image: nginx
+  env: &env-vars
+    A: "1"
+web:
+  <<: *defaults
+  image: httpd
+worker:
+  <<: [*defaults, {image: busybox}]
+env: *env-vars
+`
+
+func TestYAMLToTF_aliasesExpand(t *testing.T) {
+	assertYAMLToTF(t, aliasesYAML, `{
+  defaults = {
+    image = "nginx",
+    env = {
+      A = "1",
+    },
+  },
+  web = {
+    env = {
+      A = "1",
+    },
+    image = "httpd",
+  },
+  worker = {
+    image = "nginx",
+    env = {
+      A = "1",
+    },
+  },
+  env = {
+    A = "1",
+  },
+}`)
+}
+
+func TestYAMLToTF_mergeKeyOrder(t *testing.T) {
+	assertYAMLToTF(t, `
+base: &base {image: nginx, port: 8080, env: prod}
+web:
+  name: web
+  <<: *base
+  image: httpd
+  replicas: 2
+worker:
+  env: dev
+  <<: *base
+  image: busybox
+`, `{
+  base = { image = "nginx", port = 8080, env = "prod" },
+  web = {
+    name     = "web",
+    port     = 8080,
+    env      = "prod",
+    image    = "httpd",
+    replicas = 2,
+  },
+  worker = {
+    env   = "dev",
+    port  = 8080,
+    image = "busybox",
+  },
+}`)
+}
+
+func TestYAMLToTF_aliasesLocals(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{Aliases: AliasLocals}, aliasesYAML, `locals {
+  defaults = {
+    image = "nginx",
+    env   = local.env_vars,
+  }
+  env_vars = {
+    A = "1",
+  }
+}
+
+{
+  defaults = local.defaults,
+  web = merge(local.defaults, {
+    image = "httpd",
+  }),
+  worker = merge({ image = "busybox" }, local.defaults),
+  env    = local.env_vars,
+}`)
+}
+
+func TestYAMLToTF_aliasLocalNames(t *testing.T) {
+	assertYAMLToTFOpts(t, Options{Aliases: AliasLocals, Target: TargetLocals, Name: "value"}, "a: &value {x: 1}\nb: *value\n", `locals {
+  value_2 = { x = 1 }
+  value = {
+    a = local.value_2,
+    b = local.value_2,
+  }
+}
+`)
+	assertYAMLStreamToTF(t, Options{Aliases: AliasLocals, Documents: DocumentsLocals, Filename: "app.yaml"}, "a: 1\n---\nb: &app_1 {x: 1}\nc: *app_1\n", `locals {
+  app_1_2 = { x = 1 }
+  app_0 = {
+    a = 1,
+  }
+  app_1 = {
+    b = local.app_1_2,
+    c = local.app_1_2,
+  }
+}
+`)
+}
+
+func TestYAMLToTF_diagnostics(t *testing.T) {
+	src := `
+a: .nan
+b: &b
+  c: *b
+? [1]
+: 2
+d: !!binary aGk=
+`
+	yn := yaml.Node{}
+	yaml.Unmarshal([]byte(src), &yn)
+	h, diags := yamlToTF(&yn, Options{Filename: "test.yaml", Source: []byte(src)})
+
+	// Every problem is reported, not just the first.
+	summaries := []string{}
+	for _, d := range diags {
+		summaries = append(summaries, fmt.Sprintf("%s:%d,%d: %s", d.Subject.Filename, d.Subject.Start.Line, d.Subject.Start.Column, d.Summary))
+	}
+	assert.Equal(t, []string{
+		"test.yaml:4,6: Recursive alias",
+		"test.yaml:2,4: Unsupported number",
+		"test.yaml:5,3: Unsupported map key",
+		"test.yaml:7,4: Unsupported YAML tag",
+	}, summaries)
+	assert.Equal(t, 4, diags[1].Subject.Start.Byte)
+
+	// The rest of the output is still produced, with nulls as placeholders.
+	assert.Equal(t, `{
+  a = null,
+  b = {
+    c = null,
+  },
+  d = null,
+}`, string(h.Bytes()))
+}
+
+const documentsYAML = `
+a: 1
+---
+# second
+b: [x]
+`
+
+func TestYAMLToTF_documentsTuple(t *testing.T) {
+	assertYAMLStreamToTF(t, Options{}, documentsYAML, `[
+  {
+    a = 1,
+  },
+  {
+    # second
+    b = ["x"],
+  },
+]`)
+}
+
+func TestYAMLToTF_documentsLocals(t *testing.T) {
+	assertYAMLStreamToTF(t, Options{Documents: DocumentsLocals, Filename: "app.yaml"}, documentsYAML, `locals {
+  app_0 = {
+    a = 1,
+  }
+  app_1 = {
+    # second
+    b = ["x"],
+  }
+}
+`)
+}
+
+func TestYAMLToTF_targetKubernetesManifest(t *testing.T) {
+	const y = `# the app
+
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-app
+  namespace: prod
+spec:
+  replicas: 2 # at least
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web-app
+  namespace: prod
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web-app
+  namespace: prod
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+---
+a: 1
+`
+	assertYAMLStreamToTF(t, Options{Target: TargetKubernetesManifest, Filename: "app.yaml"}, y, `# the app
+resource "kubernetes_manifest" "deployment_prod_web_app" {
+  manifest = {
+    apiVersion = "apps/v1",
+    kind       = "Deployment",
+    metadata = {
+      name      = "web-app",
+      namespace = "prod",
+    },
+    spec = {
+      replicas = 2, # at least
+    },
+  }
+}
+
+resource "kubernetes_manifest" "service_prod_web_app" {
+  manifest = {
+    apiVersion = "v1",
+    kind       = "Service",
+    metadata = {
+      name      = "web-app",
+      namespace = "prod",
+    },
+  }
+}
+
+resource "kubernetes_manifest" "service_prod_web_app_2" {
+  manifest = {
+    apiVersion = "v1",
+    kind       = "Service",
+    metadata = {
+      name      = "web-app",
+      namespace = "prod",
+    },
+  }
+}
+
+resource "kubernetes_manifest" "namespace_prod" {
+  manifest = {
+    apiVersion = "v1",
+    kind       = "Namespace",
+    metadata = {
+      name = "prod",
+    },
+  }
+}
+
+resource "kubernetes_manifest" "app_4" {
+  manifest = {
+    a = 1,
+  }
+}
+`)
+}
+
+func TestYAMLToTF_documentsKubernetesManifest(t *testing.T) {
+	assertYAMLStreamToTF(t, Options{Documents: DocumentsKubernetesManifest, Filename: "app.yaml"}, documentsYAML, `resource "kubernetes_manifest" "app_0" {
+  manifest = {
+    a = 1,
+  }
+}
+
+resource "kubernetes_manifest" "app_1" {
+  manifest = {
+    # second
+    b = ["x"],
+  }
+}
+`)
+}
+
+func TestYAMLToTF_emptyDocuments(t *testing.T) {
+	for _, opts := range []Options{
+		{},
+		{Documents: DocumentsLocals},
+		{Documents: DocumentsKubernetesManifest},
+		{Target: TargetKubernetesManifest},
+		{Target: TargetLocals},
+		{Target: TargetVariable},
+		{Target: TargetOutput},
+		{Target: TargetTFVars},
+	} {
+		for y, same := range map[string]string{
+			"a: 1\n---\n":                      "a: 1\n",
+			"a: 1\n---\n# note\n---\nb: 2\n":   "a: 1\n# note\n---\nb: 2\n",
+			"---\n# note\n---\na: 1\n---\n":    "# note\n\na: 1\n",
+			"a: 1\n---\n---\nb: 2\n---\n---\n": "a: 1\n---\nb: 2\n",
+		} {
+			got, diags := convertSource([]byte(y), opts)
+			assert.False(t, diags.HasErrors(), "%+v %q: %s", opts, y, diags.Error())
+			want, _ := convertSource([]byte(same), opts)
+			assert.Equal(t, string(want), string(got), "%+v %q", opts, y)
+		}
+
+		got, diags := convertSource([]byte("a: 1\n---\n# note\n---\n"), opts)
+		assert.False(t, diags.HasErrors(), "%+v: %s", opts, diags.Error())
+		assert.Contains(t, string(got), "# note", "%+v", opts)
+		assert.NotContains(t, string(got), "null", "%+v", opts)
+	}
+
+	got, diags := convertSource([]byte("a: 1\n---\n# note\n---\nb: 2\n---\n"), Options{})
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, `[
+  {
+    a = 1,
+  },
+  # note
+  {
+    b = 2,
+  },
+]`, string(got))
+}
+
+func TestConverter_ConvertToTokens(t *testing.T) {
+	y := `
+base: &base
+  port: 80
+web: *base
+`
+	yn := yaml.Node{}
+	yaml.Unmarshal([]byte(y), &yn)
+	c := New(Options{Source: []byte(y), Aliases: AliasLocals, Encode: EncodeYAML})
+	tokens, diags := c.ConvertToTokens(yn.Content[0].Content[3])
+	assert.False(t, diags.HasErrors(), diags.Error())
+
+	f := hclwrite.NewEmptyFile()
+	f.Body().AppendNewBlock("resource", []string{"null_resource", "web"}).Body().SetAttributeRaw("triggers", tokens)
+	assert.Equal(t, `resource "null_resource" "web" {
+  triggers = yamlencode({
+    port = 80,
+  })
+}
+`, string(hclwrite.Format(f.Bytes())))
+}
+
+func TestConverter_ConvertBytes(t *testing.T) {
+	out, diags := New(Options{Target: TargetLocals, Name: "config"}).ConvertBytes([]byte("a: 1\n"))
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, "locals {\n  config = {\n    a = 1,\n  }\n}\n", string(out))
+}
@@ -0,0 +1,118 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"gopkg.in/yaml.v3"
+)
+
+// errorf records an error diagnostic about node y, and carries on converting
+// so that we can report every problem at once.
+func (c *conversion) errorf(y *yaml.Node, summary string, detail string, args ...any) {
+	c.diags = append(c.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  c.nodeRange(y).Ptr(),
+	})
+}
+
+// lineErrorf records an error diagnostic about a whole line of the source, for
+// problems that aren't about any one node.
+func (c *conversion) lineErrorf(line int, summary string, detail string, args ...any) {
+	c.diags = append(c.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject: &hcl.Range{
+			Filename: c.opts.Filename,
+			Start:    sourcePos(c.opts.Source, line, 1),
+			End:      sourcePos(c.opts.Source, line, len(c.opts.Source)+1),
+		},
+	})
+}
+
+// warnf records a warning diagnostic about node y, for something that
+// converted, but maybe not the way the user wants.
+func (c *conversion) warnf(y *yaml.Node, summary string, detail string, args ...any) {
+	c.diags = append(c.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  c.nodeRange(y).Ptr(),
+	})
+}
+
+// reportOnce calls report to record a diagnostic about y, unless it has
+// already been recorded. An anchored node is converted again for each alias to
+// it, but its problems only need reporting once. A diagnostic that was
+// discarded since, because a flow collection was converted again, counts as
+// not recorded.
+func (c *conversion) reportOnce(y *yaml.Node, report func()) {
+	if d := c.reported[y]; d != nil && slices.Contains(c.diags, d) {
+		return
+	}
+	report()
+	c.reported[y] = c.diags[len(c.diags)-1]
+}
+
+// placeholderTokens stands in for a value that couldn't be converted.
+func (c *conversion) placeholderTokens() []*hclwrite.Token {
+	return []*hclwrite.Token{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte("null"),
+		},
+	}
+}
+
+// nodeRange returns the source range of y. yaml.v3 only tells us where a node
+// starts, so for anything but a single-line scalar the range is just that
+// first character.
+func (c *conversion) nodeRange(y *yaml.Node) hcl.Range {
+	start := sourcePos(c.opts.Source, y.Line, y.Column)
+	width := 1
+	if y.Kind == yaml.ScalarNode && y.Style == 0 && y.Value != "" && !bytes.ContainsRune([]byte(y.Value), '\n') {
+		width = utf8.RuneCountInString(y.Value)
+	} else if y.Kind == yaml.AliasNode {
+		width = utf8.RuneCountInString(y.Value) + 1
+	}
+	end := sourcePos(c.opts.Source, y.Line, y.Column+width)
+	return hcl.Range{
+		Filename: c.opts.Filename,
+		Start:    start,
+		End:      end,
+	}
+}
+
+// sourcePos converts a 1-based line and (character) column into an hcl.Pos,
+// finding the byte offset in src if we have it. Columns past the end of the
+// line are clamped to it.
+func sourcePos(src []byte, line, column int) hcl.Pos {
+	pos := hcl.Pos{Line: line, Column: column}
+	if src == nil {
+		return pos
+	}
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(src[offset:], '\n')
+		if i < 0 {
+			return pos
+		}
+		offset += i + 1
+	}
+	col := 1
+	for ; col < column && offset < len(src) && src[offset] != '\n'; col++ {
+		_, size := utf8.DecodeRune(src[offset:])
+		offset += size
+	}
+	pos.Column = col
+	pos.Byte = offset
+	return pos
+}
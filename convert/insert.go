@@ -0,0 +1,288 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/nfi-hashicorp/yaml2tf/terraformfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// blockLabels is how many labels each kind of top-level block has, which is
+// how addresses tell the labels apart from the nested blocks after them.
+var blockLabels = map[string]int{
+	"data":      2,
+	"locals":    0,
+	"module":    1,
+	"output":    1,
+	"provider":  1,
+	"resource":  2,
+	"terraform": 0,
+	"variable":  1,
+}
+
+// address says which attribute to insert a value into: Name, in the block of
+// kind Type with Labels, or in the blocks named by Nested within that. A
+// top-level attribute, as in a .tfvars file, has no Type.
+type address struct {
+	Type   string
+	Labels []string
+	Nested []string
+	Name   string
+}
+
+// parseAddress parses an address like resource.aws_instance.web.user_data,
+// locals.cloud_init or just name, for a top-level attribute.
+func parseAddress(s string) (address, error) {
+	parts := strings.Split(s, ".")
+	for _, p := range parts {
+		if !hclsyntax.ValidIdentifier(p) {
+			return address{}, fmt.Errorf("invalid address %q; each part must be a valid Terraform identifier", s)
+		}
+	}
+	a := address{Name: parts[len(parts)-1]}
+	if len(parts) == 1 {
+		return a, nil
+	}
+	n, ok := blockLabels[parts[0]]
+	if !ok {
+		types := make([]string, 0, len(blockLabels))
+		for t := range blockLabels {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return a, fmt.Errorf("invalid address %q; must start with one of %s, or be a single name", s, strings.Join(types, ", "))
+	}
+	if len(parts) < n+2 {
+		return a, fmt.Errorf("invalid address %q; a %s block needs %d labels before the attribute name", s, parts[0], n)
+	}
+	a.Type = parts[0]
+	a.Labels = parts[1 : 1+n]
+	a.Nested = parts[1+n : len(parts)-1]
+	return a, nil
+}
+
+func (a address) String() string {
+	parts := append(append([]string{a.Type}, a.Labels...), a.Nested...)
+	if a.Type == "" {
+		parts = nil
+	}
+	return strings.Join(append(parts, a.Name), ".")
+}
+
+// findBlocks returns the blocks enclosing the attribute at a in body,
+// outermost first, or as many of them as there are. Of several locals blocks,
+// the one that already has the attribute is picked.
+func (a address) findBlocks(body *hclsyntax.Body) []*hclsyntax.Block {
+	if a.Type == "" {
+		return nil
+	}
+	var found []*hclsyntax.Block
+	for _, b := range body.Blocks {
+		if b.Type != a.Type || strings.Join(b.Labels, ".") != strings.Join(a.Labels, ".") {
+			continue
+		}
+		if found == nil || a.Type == "locals" && b.Body.Attributes[a.Name] != nil {
+			found = []*hclsyntax.Block{b}
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	for _, n := range a.Nested {
+		var nested *hclsyntax.Block
+		for _, b := range found[len(found)-1].Body.Blocks {
+			if b.Type == n && len(b.Labels) == 0 {
+				nested = b
+				break
+			}
+		}
+		if nested == nil {
+			return found
+		}
+		found = append(found, nested)
+	}
+	return found
+}
+
+// Insert converts the YAML stream in yamlSrc into a single value, as
+// ConvertToTokens does, and sets the attribute at address in the Terraform
+// configuration tf to it. An attribute that's already there keeps its place
+// and has its value replaced; otherwise it's added to the end of its block.
+// Everything else in tf is left byte for byte as it was.
+//
+// address is the block's type and labels, then the names of any blocks nested
+// within it, then the attribute's name, separated by dots, like
+// resource.aws_instance.web.user_data. A locals block is added if there isn't
+// one, but any other block must already exist.
+func (c *Converter) Insert(tf []byte, tfFilename, addr string, yamlSrc []byte) ([]byte, hcl.Diagnostics) {
+	a, err := parseAddress(addr)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   err.Error(),
+		}}
+	}
+	f, diags := hclsyntax.ParseConfig(tf, tfFilename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body := f.Body.(*hclsyntax.Body)
+	blocks := a.findBlocks(body)
+	newLocals := a.Type == "locals" && len(blocks) == 0 && len(a.Nested) == 0
+	if a.Type != "" && len(blocks) < len(a.Nested)+1 && !newLocals {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Block not found",
+			Detail:   fmt.Sprintf("%s has no block for %s.", tfFilename, a),
+		}}
+	}
+	if len(blocks) > 0 {
+		body = blocks[len(blocks)-1].Body
+	}
+	if b := blockNamed(body, a.Name); b != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Not an attribute",
+			Detail:   fmt.Sprintf("%s is a block, so it can't be set to a value.", a),
+			Subject:  b.TypeRange.Ptr(),
+		}}
+	}
+
+	opts := c.opts
+	opts.Source = yamlSrc
+	opts.Target = TargetExpr
+	opts.Documents = DocumentsTuple
+	if opts.Templates == TemplateFile {
+		yamlSrc = markTemplateDirectives(yamlSrc)
+	}
+	docs, yamlDiags := parseYAML(yamlSrc, opts.Filename)
+	diags = append(diags, yamlDiags...)
+	if diags.HasErrors() || len(docs) == 0 {
+		return nil, diags
+	}
+	node := docs[0]
+	if len(docs) > 1 {
+		node = &yaml.Node{Kind: yaml.SequenceNode, Content: docs}
+	}
+	depth := 0
+	if a.Type != "" {
+		depth = len(a.Nested) + 1
+	}
+	value, convDiags := convertValue(node, opts, depth, 2*depth+len(a.Name)+len(" = "))
+	diags = append(diags, convDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if opts.Verify {
+		diags = append(diags, verifyYAMLToTF(docs, opts)...)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+
+	text := formatValue(value, depth)
+	if attr := body.Attributes[a.Name]; attr != nil {
+		return splice(tf, trimNewline(tf, attr.Expr.Range()), text), diags
+	}
+	line := []byte(strings.Repeat("  ", depth) + a.Name + " = " + string(text) + "\n")
+	switch {
+	case a.Type == "":
+		return appendText(tf, line), diags
+	case newLocals:
+		block := append(append([]byte("locals {\n"), line...), "}\n"...)
+		if len(tf) > 0 {
+			block = append([]byte{'\n'}, block...)
+		}
+		return appendText(tf, block), diags
+	}
+
+	block := blocks[len(blocks)-1]
+	end := block.CloseBraceRange.Start.Byte
+	start := lineStart(tf, end)
+	if len(bytes.TrimSpace(tf[start:end])) == 0 {
+		return splice(tf, hcl.Range{Start: hcl.Pos{Byte: start}, End: hcl.Pos{Byte: start}}, line), diags
+	}
+	if len(block.Body.Attributes) > 0 || len(block.Body.Blocks) > 0 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Single-line block",
+			Detail:   fmt.Sprintf("Put the body of the block on lines of its own to add %s to it.", a.Name),
+			Subject:  block.CloseBraceRange.Ptr(),
+		})
+	}
+	// An empty block like {} is opened up onto several lines.
+	blockLine := tf[lineStart(tf, block.TypeRange.Start.Byte):]
+	indent := blockLine[:len(blockLine)-len(bytes.TrimLeft(blockLine, " \t"))]
+	opened := append(append([]byte{'\n'}, line...), indent...)
+	return splice(tf, hcl.Range{Start: hcl.Pos{Byte: end}, End: hcl.Pos{Byte: end}}, opened), diags
+}
+
+// formatValue formats value the way terraform fmt would as the value of an
+// attribute nested in depth blocks. hclwrite would reformat the whole file
+// around it, so it's formatted on its own, ready to splice in.
+func formatValue(value hclwrite.Tokens, depth int) []byte {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	for i := 0; i < depth; i++ {
+		body = body.AppendNewBlock("block", nil).Body()
+	}
+	body.SetAttributeRaw("value", value)
+	terraformfmt.FormatBody(f.Body())
+	src := f.Bytes()
+
+	parsed, _ := hclsyntax.ParseConfig(src, "", hcl.InitialPos)
+	sb := parsed.Body.(*hclsyntax.Body)
+	for i := 0; i < depth; i++ {
+		sb = sb.Blocks[0].Body
+	}
+	rng := trimNewline(src, sb.Attributes["value"].Expr.Range())
+	return src[rng.Start.Byte:rng.End.Byte]
+}
+
+// blockNamed returns the first block of type name in body, if any.
+func blockNamed(body *hclsyntax.Body, name string) *hclsyntax.Block {
+	for _, b := range body.Blocks {
+		if b.Type == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// trimNewline returns rng without the newline that ends a heredoc, so that
+// the newline after it stays put when it's replaced.
+func trimNewline(src []byte, rng hcl.Range) hcl.Range {
+	if rng.End.Byte > rng.Start.Byte && src[rng.End.Byte-1] == '\n' {
+		rng.End.Byte--
+	}
+	return rng
+}
+
+// lineStart returns the offset of the start of the line holding offset i.
+func lineStart(src []byte, i int) int {
+	return bytes.LastIndexByte(src[:i], '\n') + 1
+}
+
+// appendText returns a copy of src with text on the end, on a line of its own.
+func appendText(src, text []byte) []byte {
+	out := append([]byte{}, src...)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return append(out, text...)
+}
+
+// splice returns a copy of src with the bytes in rng replaced by text.
+func splice(src []byte, rng hcl.Range, text []byte) []byte {
+	out := make([]byte, 0, len(src)-(rng.End.Byte-rng.Start.Byte)+len(text))
+	out = append(out, src[:rng.Start.Byte]...)
+	out = append(out, text...)
+	return append(out, src[rng.End.Byte:]...)
+}
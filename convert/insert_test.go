@@ -0,0 +1,148 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertInsert(t *testing.T, opts Options, tf, addr, y, want string) {
+	t.Helper()
+	out, diags := New(opts).Insert([]byte(tf), "main.tf", addr, []byte(y))
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, want, string(out))
+}
+
+func TestInsert_replace(t *testing.T) {
+	// The unusual spacing elsewhere shows the rest of the file is untouched.
+	tf := `resource "aws_instance"   "web" {
+  ami           = "ami-123"
+  user_data     = templatefile("${path.module}/cloud-init.yaml.tpl", {})
+  tags = {   Name = "web" }
+}
+`
+	assertInsert(t, Options{Encode: EncodeCloudConfig}, tf, "resource.aws_instance.web.user_data", `
+# packages to install
+packages:
+  - nginx
+`, `resource "aws_instance"   "web" {
+  ami           = "ami-123"
+  user_data     = "#cloud-config\n${yamlencode({
+    # packages to install
+    packages = [
+      "nginx",
+    ],
+  })}"
+  tags = {   Name = "web" }
+}
+`)
+}
+
+func TestInsert_replaceHeredoc(t *testing.T) {
+	tf := `locals {
+  script = <<EOT
+echo hi
+EOT
+  other = 1
+}
+`
+	assertInsert(t, Options{}, tf, "locals.script", "a: 1\n", `locals {
+  script = {
+    a = 1,
+  }
+  other = 1
+}
+`)
+	assertInsert(t, Options{}, tf, "locals.script", "|\n  echo bye\n", `locals {
+  script = <<-EOT
+    echo bye
+  EOT
+  other = 1
+}
+`)
+}
+
+func TestInsert_create(t *testing.T) {
+	assertInsert(t, Options{}, `resource "aws_instance" "web" {
+  ami = "ami-123"
+
+  root_block_device {
+    volume_size = 8
+  }
+}
+`, "resource.aws_instance.web.root_block_device.tags", "name: root\n", `resource "aws_instance" "web" {
+  ami = "ami-123"
+
+  root_block_device {
+    volume_size = 8
+    tags = {
+      name = "root",
+    }
+  }
+}
+`)
+
+	assertInsert(t, Options{}, `module "app" {}
+`, "module.app.config", "a: 1\n", `module "app" {
+  config = {
+    a = 1,
+  }
+}
+`)
+
+	assertInsert(t, Options{}, `region = "us-east-1"`, "config", "a: 1\n", `region = "us-east-1"
+config = {
+  a = 1,
+}
+`)
+}
+
+func TestInsert_locals(t *testing.T) {
+	assertInsert(t, Options{}, `locals {
+  a = 1
+}
+
+locals {
+  b = 2
+}
+`, "locals.b", "3", `locals {
+  a = 1
+}
+
+locals {
+  b = 3
+}
+`)
+
+	assertInsert(t, Options{}, `variable "x" {}
+`, "locals.b", "3", `variable "x" {}
+
+locals {
+  b = 3
+}
+`)
+}
+
+func TestInsert_errors(t *testing.T) {
+	tf := `resource "aws_instance" "web" {
+  ebs_block_device {
+  }
+}
+
+module "one" { source = "./one" }
+`
+	for addr, summary := range map[string]string{
+		"resource.aws_instance.web":                     "Invalid address",
+		"bogus.thing.x":                                 "Invalid address",
+		"resource.aws_instance.db.user_data":            "Block not found",
+		"resource.aws_instance.web.root_block_device.x": "Block not found",
+		"resource.aws_instance.web.ebs_block_device":    "Not an attribute",
+		"module.one.config":                             "Single-line block",
+	} {
+		_, diags := New(Options{}).Insert([]byte(tf), "main.tf", addr, []byte("a: 1\n"))
+		if assert.True(t, diags.HasErrors(), addr) {
+			assert.Equal(t, summary, diags[0].Summary, addr)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// yamlCall is a call in a Terraform file that reads YAML from a file, which
+// Migrate can replace with the YAML converted into Terraform.
+type yamlCall struct {
+	// Range is the whole call, including any yamldecode around it.
+	Range hcl.Range
+	// Path is the YAML file, and PathRange where it's given.
+	Path      string
+	PathRange hcl.Range
+	// Decoded is whether the call is wrapped in yamldecode. If not, it's a
+	// templatefile call that gives the YAML as a string.
+	Decoded bool
+	// Template is whether the file is read with templatefile, and Vars are
+	// the tokens of each of its variables.
+	Template bool
+	Vars     map[string]templateVar
+}
+
+// templateVar is the expression given for a template variable. Compound is
+// whether it would need parentheses next to an operator.
+type templateVar struct {
+	Tokens   hclwrite.Tokens
+	Compound bool
+}
+
+// findYAMLCalls returns the calls in body that Migrate can replace:
+// yamldecode(file(PATH)), yamldecode(templatefile(PATH, VARS)), and
+// templatefile(PATH, VARS) on its own when PATH names a YAML file, like
+// x.yaml.tpl. PATH must be a literal, optionally starting with
+// ${path.module}, and is relative to dir. Calls that can't be replaced, for
+// want of literal template variables, are warned about.
+func findYAMLCalls(body *hclsyntax.Body, src []byte, dir string) ([]yamlCall, hcl.Diagnostics) {
+	var calls []yamlCall
+	var diags hcl.Diagnostics
+	inner := map[*hclsyntax.FunctionCallExpr]bool{}
+	hclsyntax.VisitAll(body, func(n hclsyntax.Node) hcl.Diagnostics {
+		call, ok := n.(*hclsyntax.FunctionCallExpr)
+		if !ok || inner[call] {
+			return nil
+		}
+		yc := yamlCall{Range: call.Range()}
+		for _, outer := range calls {
+			if outer.Range.Overlaps(yc.Range) {
+				// Its YAML is about to be replaced anyway.
+				return nil
+			}
+		}
+		if call.Name == "yamldecode" && len(call.Args) == 1 {
+			arg, ok := call.Args[0].(*hclsyntax.FunctionCallExpr)
+			if !ok {
+				return nil
+			}
+			inner[arg] = true
+			yc.Decoded = true
+			call = arg
+		}
+		switch {
+		case call.Name == "file" && len(call.Args) == 1 && yc.Decoded:
+		case call.Name == "templatefile" && len(call.Args) == 2:
+			yc.Template = true
+		default:
+			return nil
+		}
+		path, ok := literalPath(call.Args[0])
+		if !ok || !yc.Decoded && !strings.Contains(path, ".yaml") && !strings.Contains(path, ".yml") {
+			return nil
+		}
+		yc.Path = filepath.Join(dir, path)
+		if filepath.IsAbs(path) {
+			yc.Path = path
+		}
+		yc.PathRange = call.Args[0].Range()
+		if yc.Template {
+			vars, ok := templateVars(call.Args[1], src)
+			if !ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Template variables aren't an object",
+					Detail:   fmt.Sprintf("The variables for %s must be written out as an object, like { name = var.name }, to be substituted into it, so this call is left as it is.", path),
+					Subject:  call.Args[1].Range().Ptr(),
+				})
+				return nil
+			}
+			yc.Vars = vars
+		}
+		calls = append(calls, yc)
+		return nil
+	})
+	return calls, diags
+}
+
+// literalPath returns the path that expr gives, if it's a literal string,
+// optionally starting with ${path.module}.
+func literalPath(expr hclsyntax.Expression) (string, bool) {
+	t, ok := expr.(*hclsyntax.TemplateExpr)
+	if !ok {
+		return "", false
+	}
+	var b strings.Builder
+	for i, p := range t.Parts {
+		switch p := p.(type) {
+		case *hclsyntax.LiteralValueExpr:
+			if p.Val.Type() != cty.String || !p.Val.IsKnown() || p.Val.IsNull() {
+				return "", false
+			}
+			b.WriteString(p.Val.AsString())
+		case *hclsyntax.ScopeTraversalExpr:
+			attr, ok := p.Traversal[len(p.Traversal)-1].(hcl.TraverseAttr)
+			if i != 0 || len(p.Traversal) != 2 || p.Traversal.RootName() != "path" || !ok || attr.Name != "module" {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	path := b.String()
+	if len(t.Parts) > 1 {
+		// Relative to ${path.module}, which is where relative paths are
+		// taken from anyway.
+		path = strings.TrimPrefix(path, "/")
+	}
+	return path, path != ""
+}
+
+// templateVars returns each variable in the templatefile variables expr, if
+// it's an object constructor.
+func templateVars(expr hclsyntax.Expression, src []byte) (map[string]templateVar, bool) {
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil, false
+	}
+	vars := map[string]templateVar{}
+	for _, item := range obj.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String || !key.IsKnown() || key.IsNull() {
+			return nil, false
+		}
+		rng := item.ValueExpr.Range()
+		text := src[rng.Start.Byte:rng.End.Byte]
+		f, parseDiags := hclwrite.ParseConfig(append(append([]byte("value = "), text...), '\n'), "", hcl.InitialPos)
+		if parseDiags.HasErrors() {
+			return nil, false
+		}
+		v := templateVar{Tokens: f.Body().GetAttribute("value").Expr().BuildTokens(nil)}
+		switch item.ValueExpr.(type) {
+		case *hclsyntax.ScopeTraversalExpr, *hclsyntax.RelativeTraversalExpr, *hclsyntax.IndexExpr, *hclsyntax.LiteralValueExpr,
+			*hclsyntax.TemplateExpr, *hclsyntax.FunctionCallExpr, *hclsyntax.TupleConsExpr, *hclsyntax.ObjectConsExpr, *hclsyntax.ParenthesesExpr:
+		default:
+			v.Compound = true
+		}
+		vars[key.AsString()] = v
+	}
+	return vars, true
+}
+
+// substituteVars replaces each reference to a template variable in tokens
+// with a copy of the variable's tokens, parenthesized if it's compound and
+// has anything but delimiters either side. Object keys, attribute names,
+// function names and the names bound by for expressions and directives that
+// happen to share a variable's name are left alone.
+//
+// It also returns the names of any other references, which the template has
+// no variable for.
+func substituteVars(tokens hclwrite.Tokens, vars map[string]templateVar) (hclwrite.Tokens, []string) {
+	out := make(hclwrite.Tokens, 0, len(tokens))
+	var missing []string
+	var scopes []*forScope
+	depth := 0
+	for i, t := range tokens {
+		var prev, next hclsyntax.TokenType
+		if i > 0 {
+			prev = tokens[i-1].Type
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1].Type
+		}
+		out = append(out, t)
+		switch t.Type {
+		case hclsyntax.TokenOBrack, hclsyntax.TokenOBrace, hclsyntax.TokenOParen, hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			depth++
+			continue
+		case hclsyntax.TokenCBrack, hclsyntax.TokenCBrace, hclsyntax.TokenCParen, hclsyntax.TokenTemplateSeqEnd:
+			depth--
+			// A for expression's names go out of scope with its brackets,
+			// and a for directive's come into scope after its header.
+			for len(scopes) > 0 && !scopes[len(scopes)-1].directive && depth < scopes[len(scopes)-1].depth {
+				scopes = scopes[:len(scopes)-1]
+			}
+			if len(scopes) > 0 && scopes[len(scopes)-1].directive && depth < scopes[len(scopes)-1].depth {
+				scopes[len(scopes)-1].active = true
+			}
+			continue
+		case hclsyntax.TokenColon:
+			if len(scopes) > 0 && !scopes[len(scopes)-1].directive && depth == scopes[len(scopes)-1].depth {
+				scopes[len(scopes)-1].active = true
+			}
+			continue
+		case hclsyntax.TokenIdent:
+		default:
+			continue
+		}
+
+		name := string(t.Bytes)
+		if len(scopes) > 0 && scopes[len(scopes)-1].binding {
+			s := scopes[len(scopes)-1]
+			if name == "in" {
+				s.binding = false
+			} else {
+				s.names = append(s.names, name)
+			}
+			continue
+		}
+		switch {
+		case name == "for" && (prev == hclsyntax.TokenOBrack || prev == hclsyntax.TokenOBrace || prev == hclsyntax.TokenTemplateControl):
+			scopes = append(scopes, &forScope{depth: depth, directive: prev == hclsyntax.TokenTemplateControl, binding: true})
+			continue
+		case name == "endfor" && prev == hclsyntax.TokenTemplateControl:
+			for j := len(scopes) - 1; j >= 0; j-- {
+				if scopes[j].directive {
+					scopes = scopes[:j]
+					break
+				}
+			}
+			continue
+		case prev == hclsyntax.TokenDot || next == hclsyntax.TokenEqual || next == hclsyntax.TokenOParen || templateKeywords[name] || bound(scopes, name):
+			continue
+		}
+		v, ok := vars[name]
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			continue
+		}
+
+		out = out[:len(out)-1]
+		parens := v.Compound && !(standsAlone(prev, opening) && standsAlone(next, closing))
+		if parens {
+			out = append(out, &hclwrite.Token{Type: hclsyntax.TokenOParen, Bytes: []byte("(")})
+		}
+		for _, vt := range v.Tokens {
+			c := *vt
+			out = append(out, &c)
+		}
+		if parens {
+			out = append(out, &hclwrite.Token{Type: hclsyntax.TokenCParen, Bytes: []byte(")")})
+		}
+	}
+	return out, missing
+}
+
+// forScope is a for expression or directive that substituteVars is in. Its
+// names are bound from the colon after its header, or the end of the
+// directive's header, to the end of the expression, or the endfor.
+type forScope struct {
+	names     []string
+	depth     int
+	directive bool
+	// binding is whether the names are still being read, and active whether
+	// they're in scope yet.
+	binding bool
+	active  bool
+}
+
+func bound(scopes []*forScope, name string) bool {
+	for _, s := range scopes {
+		if s.active && slices.Contains(s.names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateKeywords are the identifiers in a template that aren't references.
+var templateKeywords = map[string]bool{
+	"true": true, "false": true, "null": true,
+	"for": true, "in": true, "if": true, "else": true, "endif": true, "endfor": true,
+}
+
+// opening and closing are the tokens that can come before and after an
+// expression without binding to it more tightly than any operator.
+var (
+	opening = []hclsyntax.TokenType{hclsyntax.TokenTemplateInterp, hclsyntax.TokenOParen, hclsyntax.TokenOBrack, hclsyntax.TokenOBrace, hclsyntax.TokenComma, hclsyntax.TokenColon, hclsyntax.TokenEqual, hclsyntax.TokenNewline, hclsyntax.TokenIdent}
+	closing = []hclsyntax.TokenType{hclsyntax.TokenTemplateSeqEnd, hclsyntax.TokenCParen, hclsyntax.TokenCBrack, hclsyntax.TokenCBrace, hclsyntax.TokenComma, hclsyntax.TokenColon, hclsyntax.TokenNewline}
+)
+
+func standsAlone(t hclsyntax.TokenType, delims []hclsyntax.TokenType) bool {
+	for _, d := range delims {
+		if t == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Migrate replaces the calls in the Terraform configuration tf that read YAML
+// files, yamldecode(file(...)) and templatefile(...), with the YAML converted
+// into Terraform, as findYAMLCalls describes. Template variables are
+// substituted into templates as the expressions they're given as, and
+// templatefile calls outside yamldecode are wrapped in yamlencode to keep
+// giving a string, or for YAML that starts #cloud-config, in the cloud-config
+// string.
+//
+// Calls that can't be replaced are left as they are with a warning. The
+// result is nil if there were errors, and tf if there was nothing to replace.
+func (c *Converter) Migrate(tf []byte, filename string) ([]byte, hcl.Diagnostics) {
+	f, diags := hclsyntax.ParseConfig(tf, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	calls, findDiags := findYAMLCalls(f.Body.(*hclsyntax.Body), tf, filepath.Dir(filename))
+	diags = append(diags, findDiags...)
+
+	// Replacing from the end keeps the earlier ranges valid.
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].Range.Start.Byte > calls[j].Range.Start.Byte
+	})
+	out := tf
+	for _, call := range calls {
+		start := lineStart(tf, call.Range.Start.Byte)
+		line := tf[start:]
+		depth := (len(line) - len(bytes.TrimLeft(line, " "))) / 2
+		text, callDiags := c.migrateCall(call, depth)
+		diags = append(diags, callDiags...)
+		if text == nil {
+			continue
+		}
+		// Every splice so far has given valid Terraform, so any problem now
+		// is with this one.
+		out = splice(out, call.Range, text)
+		if _, parseDiags := hclsyntax.ParseConfig(out, filename, hcl.InitialPos); parseDiags.HasErrors() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid migrated value",
+				Detail:   fmt.Sprintf("Converting %s gives invalid Terraform: %s: %s", call.Path, parseDiags[0].Summary, parseDiags[0].Detail),
+				Subject:  call.Range.Ptr(),
+			})
+			break
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return out, diags
+}
+
+// migrateCall converts the YAML that call reads, for a call on a line
+// indented depth levels, returning the formatted value to replace it with, or
+// nil if it can't be.
+func (c *Converter) migrateCall(call yamlCall, depth int) ([]byte, hcl.Diagnostics) {
+	src, err := os.ReadFile(call.Path)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Can't read YAML file",
+			Detail:   err.Error(),
+			Subject:  call.PathRange.Ptr(),
+		}}
+	}
+	opts := c.opts
+	opts.Source = src
+	opts.Filename = call.Path
+	opts.Target = TargetExpr
+	opts.Documents = DocumentsTuple
+	opts.Templates = TemplateLiteral
+	opts.Encode = EncodeNone
+	if !call.Decoded {
+		opts.Encode = EncodeYAML
+	}
+	yamlSrc := src
+	if !call.Decoded && bytes.HasPrefix(src, []byte("#cloud-config\n")) {
+		// The cloud-config string has the header already. Blanking it keeps
+		// the line numbers.
+		opts.Encode = EncodeCloudConfig
+		yamlSrc = append([]byte{'\n'}, src[len("#cloud-config\n"):]...)
+	}
+	if call.Template {
+		opts.Templates = TemplateFile
+		opts.Verify = false
+		yamlSrc = markTemplateDirectives(yamlSrc)
+	}
+
+	docs, diags := parseYAML(yamlSrc, opts.Filename)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if len(docs) != 1 {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagWarning,
+			Summary:  "Not a single YAML document",
+			Detail:   fmt.Sprintf("%s has %d YAML documents, but only a single document can be inlined, so this call is left as it is.", call.Path, len(docs)),
+			Subject:  call.PathRange.Ptr(),
+		}}
+	}
+	value, convDiags := convertValue(docs[0], opts, depth, call.Range.Start.Column-1)
+	diags = append(diags, convDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if opts.Verify {
+		diags = append(diags, verifyYAMLToTF(docs, opts)...)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+	if call.Template {
+		var missing []string
+		value, missing = substituteVars(value, call.Vars)
+		if len(missing) > 0 {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Template variables not given",
+				Detail:   fmt.Sprintf("%s refers to %s, which the call doesn't give it, so this call is left as it is.", call.Path, strings.Join(missing, ", ")),
+				Subject:  call.PathRange.Ptr(),
+			})
+		}
+	}
+	return formatValue(value, depth), diags
+}
@@ -0,0 +1,181 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertMigrate(t *testing.T, files map[string]string, tf, want string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	out, diags := New(Options{}).Migrate([]byte(tf), filepath.Join(dir, "main.tf"))
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, want, string(out))
+}
+
+func TestMigrate_yamldecodeFile(t *testing.T) {
+	assertMigrate(t, map[string]string{"config.yaml": "# the port\nport: 80\n"}, `locals {
+  config   = yamldecode(file("${path.module}/config.yaml"))
+  port     = local.config.port
+  other    = yamldecode(file(var.path))
+}
+`, `locals {
+  config   = {
+    # the port
+    port = 80,
+  }
+  port     = local.config.port
+  other    = yamldecode(file(var.path))
+}
+`)
+}
+
+func TestMigrate_templatefile(t *testing.T) {
+	assertMigrate(t, map[string]string{
+		"cloud-init.yaml.tpl": `#cloud-config
+hostname: ${name}
+write_files:
+  - path: /etc/motd
+    content: "Welcome to ${name}"
+%{ for p in packages ~}
+  - path: /etc/${p}
+%{ endfor ~}
+`,
+		"script.sh.tpl": "echo ${name}\n",
+	}, `resource "aws_instance" "web" {
+  user_data = templatefile("cloud-init.yaml.tpl", {
+    name     = "web-${var.env}"
+    packages = var.extra_a + var.extra_b
+  })
+  script = templatefile("script.sh.tpl", { name = "web" })
+}
+`, `resource "aws_instance" "web" {
+  user_data = "#cloud-config\n${yamlencode({
+    hostname = "web-${var.env}",
+    write_files = concat(
+      [
+        {
+          path    = "/etc/motd",
+          content = "Welcome to ${"web-${var.env}"}",
+        },
+      ],
+      [for p in var.extra_a + var.extra_b : {
+        path = "/etc/${p}",
+      }]
+    ),
+  })}"
+  script = templatefile("script.sh.tpl", { name = "web" })
+}
+`)
+}
+
+func TestMigrate_yamldecodeTemplatefile(t *testing.T) {
+	assertMigrate(t, map[string]string{"values.yaml": "replicas: ${count}\nname: app\nsurge: ${count * 2}\n"}, `module "app" {
+  values = yamldecode(templatefile("values.yaml", { count = var.min + var.extra, name = "x" }))
+}
+`, `module "app" {
+  values = {
+    replicas = var.min + var.extra,
+    name     = "app",
+    surge    = (var.min + var.extra) * 2,
+  }
+}
+`)
+}
+
+func TestMigrate_unchanged(t *testing.T) {
+	tf := "locals {\n  a = templatefile(\"x.yaml.tpl\", local.vars)\n}\n"
+	out, diags := New(Options{}).Migrate([]byte(tf), "main.tf")
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, tf, string(out))
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "Template variables aren't an object", diags[0].Summary)
+	}
+
+	_, diags = New(Options{}).Migrate([]byte("a = yamldecode(file(\"missing.yaml\"))\n"), filepath.Join(t.TempDir(), "main.tf"))
+	if assert.True(t, diags.HasErrors()) {
+		assert.Equal(t, "Can't read YAML file", diags[0].Summary)
+	}
+}
+
+func TestMigrate_forBoundVars(t *testing.T) {
+	assertMigrate(t, map[string]string{"list.yaml": "%{ for i in items ~}\n- ${i}\n%{ endfor ~}\n"}, `locals {
+  list = yamldecode(templatefile("list.yaml", { items = ["a", "b"], i = "zzz" }))
+}
+`, `locals {
+  list = [for i in ["a", "b"] : i]
+}
+`)
+}
+
+func TestMigrate_missingVars(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicas: ${count}\nname: \"app-${name}\"\n"), 0o644))
+	tf := "locals {\n  values = yamldecode(templatefile(\"values.yaml\", { other = 1 }))\n}\n"
+	out, diags := New(Options{}).Migrate([]byte(tf), filepath.Join(dir, "main.tf"))
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, tf, string(out))
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "Template variables not given", diags[0].Summary)
+		assert.Contains(t, diags[0].Detail, "count, name")
+	}
+}
+
+func TestMigrate_invalidResult(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("x: ${a}\n"), 0o644))
+	// The heredoc's closing marker ends up followed by the object's comma.
+	tf := "a = yamldecode(templatefile(\"values.yaml\", { a = <<EOT\nhi\nEOT\n }))\n"
+	out, diags := New(Options{}).Migrate([]byte(tf), filepath.Join(dir, "main.tf"))
+	assert.Nil(t, out)
+	if assert.True(t, diags.HasErrors()) {
+		assert.Equal(t, "Invalid migrated value", diags[len(diags)-1].Summary)
+	}
+}
+
+func TestMigrate_templateHeredocsAndKeys(t *testing.T) {
+	files := map[string]string{"u.yaml.tpl": `write_files:
+  - path: /etc/app.conf
+    content: |
+      host=${hostname}
+      port=${port}
+"${keyname}": x
+`}
+	assertMigrate(t, files, `locals {
+  user_data = yamldecode(templatefile("u.yaml.tpl", { hostname = var.h, port = 80, keyname = "k" }))
+}
+`, `locals {
+  user_data = {
+    write_files = [
+      {
+        path    = "/etc/app.conf",
+        content = <<-EOT
+          host=${var.h}
+          port=${80}
+        EOT
+      },
+    ],
+    "${"k"}" = "x",
+  }
+}
+`)
+
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	tf := "locals {\n  user_data = yamldecode(templatefile(\"u.yaml.tpl\", { port = 80 }))\n}\n"
+	out, diags := New(Options{}).Migrate([]byte(tf), filepath.Join(dir, "main.tf"))
+	assert.Equal(t, tf, string(out))
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "Template variables not given", diags[0].Summary)
+		assert.Contains(t, diags[0].Detail, "hostname, keyname")
+	}
+}
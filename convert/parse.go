@@ -0,0 +1,165 @@
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlErrorLine picks the line number out of yaml.v3's syntax errors, which
+// otherwise aren't structured.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// parseYAML decodes every document in src. A syntax error stops parsing (the
+// YAML parser can't recover from one), and is returned as a diagnostic that
+// covers the whole offending line, since yaml.v3 doesn't tell us the column.
+//
+// Empty documents, like the one after a trailing `---`, are dropped, and any
+// comments in them are kept on the document before, or failing that the one
+// after. If src has no documents at all, which YAML allows, we return none
+// along with a warning, because it probably isn't what the user intended.
+func parseYAML(src []byte, filename string) ([]*yaml.Node, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	docs := []*yaml.Node{}
+	var orphaned string
+	dec := yaml.NewDecoder(bytes.NewReader(src))
+	for {
+		y := &yaml.Node{}
+		err := dec.Decode(y)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			diags = append(diags, yamlErrorDiagnostic(err, src, filename))
+			return docs, diags
+		}
+		if emptyDocument(y) {
+			if len(docs) > 0 {
+				prev := docs[len(docs)-1]
+				prev.FootComment = joinCommentLines(prev.FootComment, documentComments(y))
+			} else {
+				orphaned = joinCommentLines(orphaned, documentComments(y))
+			}
+			continue
+		}
+		y.HeadComment = joinCommentLines(orphaned, y.HeadComment)
+		orphaned = ""
+		docs = append(docs, y)
+	}
+	if len(docs) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "No YAML documents",
+			Detail:   "The input is empty or contains only comments and empty documents, so the output is empty.",
+			Subject: &hcl.Range{
+				Filename: filename,
+				Start:    hcl.InitialPos,
+				End:      hcl.InitialPos,
+			},
+		})
+	}
+	return docs, diags
+}
+
+// emptyDocument reports whether the document d has no content, which yaml.v3
+// represents as a null scalar with no text, as opposed to an explicit null.
+func emptyDocument(d *yaml.Node) bool {
+	if len(d.Content) == 0 {
+		return true
+	}
+	v := d.Content[0]
+	return v.Kind == yaml.ScalarNode && v.Tag == "!!null" && v.Value == "" && v.Style == 0 && v.Anchor == ""
+}
+
+// documentComments returns all the comments in the empty document d, in
+// source order.
+func documentComments(d *yaml.Node) string {
+	comments := []string{d.HeadComment}
+	for _, v := range d.Content {
+		comments = append(comments, v.HeadComment, v.LineComment, v.FootComment)
+	}
+	return joinCommentLines(append(comments, d.FootComment)...)
+}
+
+// joinCommentLines combines whole-line comments, one after the other.
+func joinCommentLines(comments ...string) string {
+	var nonEmpty []string
+	for _, c := range comments {
+		if c != "" {
+			nonEmpty = append(nonEmpty, c)
+		}
+	}
+	return strings.Join(nonEmpty, "\n")
+}
+
+// yamlErrorDiagnostic turns a yaml.v3 error into a diagnostic, working out
+// which line it's about as best we can. Syntax errors say "line N", except on the
+// first line where they say nothing, and the parser (as opposed to the scanner)
+// numbers lines from zero. Unknown anchors have no position at all, so we look
+// for the alias in the source.
+func yamlErrorDiagnostic(err error, src []byte, filename string) *hcl.Diagnostic {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	diag := &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid YAML",
+		Detail:   msg,
+	}
+
+	line, column := 1, 1
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		diag.Detail = m[2]
+		if isYAMLParserProblem(diag.Detail) {
+			line++
+		}
+	} else if m := yamlUnknownAnchor.FindStringSubmatch(msg); m != nil {
+		i := bytes.Index(src, []byte("*"+m[1]))
+		if i < 0 {
+			return diag
+		}
+		line = bytes.Count(src[:i], []byte{'\n'}) + 1
+		column = utf8.RuneCount(src[bytes.LastIndexByte(src[:i], '\n')+1:i]) + 1
+	} else if !isYAMLParserProblem(msg) && !isYAMLScannerProblem(msg) {
+		return diag
+	}
+
+	start := sourcePos(src, line, column)
+	end := sourcePos(src, line, len(src)+1)
+	diag.Subject = &hcl.Range{
+		Filename: filename,
+		Start:    start,
+		End:      end,
+	}
+	return diag
+}
+
+var yamlUnknownAnchor = regexp.MustCompile(`^unknown anchor '(.*)' referenced$`)
+
+// isYAMLParserProblem reports whether msg is one of the yaml.v3 parser's errors,
+// which (unlike the scanner's) have zero-based line numbers.
+func isYAMLParserProblem(msg string) bool {
+	for _, prefix := range []string{"did not find expected", "found duplicate", "found incompatible", "found undefined tag handle"} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isYAMLScannerProblem reports whether msg looks like a yaml.v3 scanner error,
+// as opposed to one about the document's structure, like excessive aliasing.
+func isYAMLScannerProblem(msg string) bool {
+	for _, prefix := range []string{"found", "could not find", "did not find", "mapping values", "block sequence entries", "control characters", "invalid", "incomplete", "offset"} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
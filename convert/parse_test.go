@@ -0,0 +1,68 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseYAML_syntaxError(t *testing.T) {
+	src := "a: 1\nb: [1, 2\nc: 3\n"
+	docs, diags := parseYAML([]byte(src), "test.yaml")
+	assert.Empty(t, docs)
+	assert.Len(t, diags, 1)
+	assert.Equal(t, hcl.DiagError, diags[0].Severity)
+	assert.Equal(t, "did not find expected ',' or ']'", diags[0].Detail)
+	assert.Equal(t, &hcl.Range{
+		Filename: "test.yaml",
+		Start:    hcl.Pos{Line: 2, Column: 1, Byte: 5},
+		End:      hcl.Pos{Line: 2, Column: 9, Byte: 13},
+	}, diags[0].Subject)
+}
+
+func TestParseYAML_firstLineError(t *testing.T) {
+	_, diags := parseYAML([]byte("a: b: c\n"), "test.yaml")
+	assert.Len(t, diags, 1)
+	assert.Equal(t, 1, diags[0].Subject.Start.Line)
+}
+
+func TestParseYAML_unknownAnchor(t *testing.T) {
+	_, diags := parseYAML([]byte("x: 1\na: *y\n"), "test.yaml")
+	assert.Len(t, diags, 1)
+	assert.Equal(t, hcl.Pos{Line: 2, Column: 4, Byte: 8}, diags[0].Subject.Start)
+}
+
+func TestParseYAML_empty(t *testing.T) {
+	for _, src := range []string{"", "# just a comment\n"} {
+		docs, diags := parseYAML([]byte(src), "test.yaml")
+		assert.Empty(t, docs)
+		assert.False(t, diags.HasErrors())
+		assert.Len(t, diags, 1)
+		assert.Equal(t, "No YAML documents", diags[0].Summary)
+	}
+}
+
+func TestParseYAML_documents(t *testing.T) {
+	docs, diags := parseYAML([]byte("a: 1\n---\nb: 2\n"), "test.yaml")
+	assert.Empty(t, diags)
+	assert.Len(t, docs, 2)
+}
+
+func TestParseYAML_emptyDocuments(t *testing.T) {
+	docs, diags := parseYAML([]byte("---\n# first\n---\na: 1\n---\n# between\n---\nb: 2\n---\n"), "test.yaml")
+	assert.Empty(t, diags)
+	if assert.Len(t, docs, 2) {
+		assert.Equal(t, "# first", docs[0].HeadComment)
+		assert.Equal(t, "# between", docs[0].FootComment)
+		assert.Equal(t, "", docs[1].FootComment)
+	}
+
+	docs, diags = parseYAML([]byte("---\n# nothing\n---\n"), "test.yaml")
+	assert.Empty(t, docs)
+	assert.Len(t, diags, 1)
+	assert.Equal(t, "No YAML documents", diags[0].Summary)
+
+	docs, _ = parseYAML([]byte("~\n---\n"), "test.yaml")
+	assert.Len(t, docs, 1, "an explicit null is kept")
+}
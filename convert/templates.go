@@ -0,0 +1,385 @@
+package convert
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/nfi-hashicorp/yaml2tf/terraformfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources for Terraform's templatefile are often YAML with directives on
+// lines of their own:
+//
+//	runcmd:
+//	%{ for cmd in commands ~}
+//	  - ${cmd}
+//	%{ endfor ~}
+//
+// That isn't YAML until the directives are out of the way, so in the
+// templatefile mode markTemplateDirectives comments them out before parsing.
+// The converter then finds them again by line number, and turns each one that
+// wraps list items into the equivalent expression.
+
+// templateDirectiveLine matches a line holding nothing but a directive, with
+// the directive itself in the second group and its keyword and header in the
+// third.
+var templateDirectiveLine = regexp.MustCompile(`^([ \t]*)(%\{~?[ \t]*((?:for|if)[ \t].*?|endfor|else|endif)[ \t]*~?\})[ \t]*$`)
+
+// markTemplateDirectives comments out every line of src that holds just a
+// template directive, keeping its indentation, and the line numbers.
+func markTemplateDirectives(src []byte) []byte {
+	lines := bytes.Split(src, []byte{'\n'})
+	for i, line := range lines {
+		if m := templateDirectiveLine.FindSubmatchIndex(line); m != nil {
+			marked := append([]byte{}, line[:m[4]]...)
+			marked = append(marked, '#')
+			lines[i] = append(marked, line[m[4]:]...)
+		}
+	}
+	return bytes.Join(lines, []byte{'\n'})
+}
+
+// isTemplateMarker reports whether a comment line is a directive commented out
+// by markTemplateDirectives.
+func isTemplateMarker(comment string) bool {
+	return strings.HasPrefix(comment, "#%") && templateDirectiveLine.MatchString(comment[1:])
+}
+
+// unmarkTemplateDirectives undoes markTemplateDirectives for the lines of a
+// block scalar, where directives are just part of the text.
+func unmarkTemplateDirectives(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if isTemplateMarker(strings.TrimRight(trimmed, "\n")) {
+			lines[i] = line[:len(line)-len(trimmed)] + trimmed[1:]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// templateBlock is a %{ for } or %{ if } directive, along with its matching
+// %{ endfor } or %{ endif }, around the list items it repeats or guards.
+type templateBlock struct {
+	// keyword is "for" or "if", and header is the rest of the opening
+	// directive: "x in xs", or the condition.
+	keyword, header string
+	// start, els and end are the lines of the opening directive, any
+	// %{ else }, and the closing directive. els is zero without an else.
+	start, els, end int
+}
+
+// scanTemplateBlocks finds the directives in the source of docs and matches
+// them up into blocks, each claimed by the sequence whose items it wraps.
+// Directives that can't be translated are reported.
+func (c *conversion) scanTemplateBlocks(docs []*yaml.Node) {
+	inScalar := map[int]bool{}
+	for _, d := range docs {
+		c.scanBlockScalars(d, inScalar)
+	}
+
+	var blocks, open []*templateBlock
+	for i, line := range c.lines {
+		n := i + 1
+		m := templateDirectiveLine.FindSubmatch(line)
+		if m == nil || inScalar[n] {
+			continue
+		}
+		directive := string(m[3])
+		keyword := strings.Fields(directive)[0]
+		switch keyword {
+		case "for", "if":
+			b := &templateBlock{
+				keyword: keyword,
+				header:  strings.TrimSpace(directive[len(keyword):]),
+				start:   n,
+			}
+			blocks = append(blocks, b)
+			open = append(open, b)
+		case "else":
+			if len(open) == 0 || open[len(open)-1].keyword != "if" || open[len(open)-1].els != 0 {
+				c.lineErrorf(n, "Unexpected template directive", "There is no %%{ if } for this %%{ else } to belong to.")
+				continue
+			}
+			open[len(open)-1].els = n
+		case "endfor", "endif":
+			want := strings.TrimPrefix(keyword, "end")
+			if len(open) == 0 || open[len(open)-1].keyword != want {
+				c.lineErrorf(n, "Unexpected template directive", "There is no %%{ %s } for this %%{ %s } to end.", want, keyword)
+				continue
+			}
+			open[len(open)-1].end = n
+			open = open[:len(open)-1]
+		}
+	}
+	for _, b := range open {
+		c.lineErrorf(b.start, "Unterminated template directive", "This %%{ %s } has no matching %%{ end%s }.", b.keyword, b.keyword)
+	}
+
+	unclaimed := map[*templateBlock]bool{}
+	for _, b := range blocks {
+		if b.end != 0 && c.checkTemplateHeader(b) {
+			unclaimed[b] = true
+		}
+	}
+	for _, d := range docs {
+		c.claimTemplateBlocks(d, blocks, unclaimed)
+	}
+	for _, b := range blocks {
+		if unclaimed[b] {
+			c.lineErrorf(b.start, "Unsupported template directive", "Only %%{ for } and %%{ if } directives around whole list items can be converted into Terraform expressions.")
+		}
+	}
+}
+
+// scanBlockScalars records the lines holding the content of literal and folded
+// scalars within y, and puts back any directives in them.
+func (c *conversion) scanBlockScalars(y *yaml.Node, lines map[int]bool) {
+	if y.Kind == yaml.ScalarNode && y.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && y.Value != "" {
+		y.Value = unmarkTemplateDirectives(y.Value)
+		// The content runs for as long as lines are blank, or at least as
+		// indented as its first line.
+		indent := -1
+		for n := y.Line + 1; n <= len(c.lines); n++ {
+			line := c.lines[n-1]
+			if len(bytes.TrimSpace(line)) == 0 {
+				lines[n] = true
+				continue
+			}
+			lineIndent := len(line) - len(bytes.TrimLeft(line, " "))
+			if indent < 0 {
+				indent = lineIndent
+			}
+			if lineIndent < indent {
+				break
+			}
+			lines[n] = true
+		}
+	}
+	for _, child := range y.Content {
+		c.scanBlockScalars(child, lines)
+	}
+}
+
+// checkTemplateHeader reports whether the header of b parses, reporting it if
+// not.
+func (c *conversion) checkTemplateHeader(b *templateBlock) bool {
+	src := b.header
+	if b.keyword == "for" {
+		src = "[for " + b.header + " : null]"
+	}
+	if _, diags := hclsyntax.ParseExpression([]byte(src), c.opts.Filename, hcl.InitialPos); diags.HasErrors() {
+		c.lineErrorf(b.start, "Invalid template directive", "This %%{ %s } can't be parsed: %s", b.keyword, diags[0].Detail)
+		return false
+	}
+	return true
+}
+
+// claimTemplateBlocks gives each unclaimed block to the outermost sequence
+// within y that has items inside it.
+func (c *conversion) claimTemplateBlocks(y *yaml.Node, blocks []*templateBlock, unclaimed map[*templateBlock]bool) {
+	if y.Kind == yaml.SequenceNode {
+		for _, b := range blocks {
+			if !unclaimed[b] {
+				continue
+			}
+			for _, item := range y.Content {
+				if item.Line > b.start && item.Line < b.end {
+					c.templateBlocks[y] = append(c.templateBlocks[y], b)
+					delete(unclaimed, b)
+					break
+				}
+			}
+		}
+	}
+	for _, child := range y.Content {
+		c.claimTemplateBlocks(child, blocks, unclaimed)
+	}
+}
+
+// templateSegments converts items, some of which are inside blocks, into
+// tuple-valued expressions to concatenate: a tuple for each run of items
+// outside any block, and a for expression or conditional for each block.
+// blocks must be in order of their start, as scanTemplateBlocks finds them.
+// The tuples are given style, so that the branches of a conditional can be
+// kept on one line where they fit.
+func (c *conversion) templateSegments(items []*yaml.Node, blocks []*templateBlock, style yaml.Style) [][]*hclwrite.Token {
+	var segs [][]*hclwrite.Token
+	var run []*yaml.Node
+	flush := func() {
+		if len(run) > 0 {
+			c.startValue("", true)
+			segs = append(segs, c.yamlIntoTFTokens(&yaml.Node{
+				Kind:    yaml.SequenceNode,
+				Style:   style,
+				Content: run,
+			}))
+			run = nil
+		}
+	}
+	i := 0
+	for i < len(items) || len(blocks) > 0 {
+		if i == len(items) || len(blocks) > 0 && blocks[0].start < items[i].Line {
+			b := blocks[0]
+			j := 1
+			for j < len(blocks) && blocks[j].start < b.end {
+				j++
+			}
+			inner := blocks[1:j]
+			blocks = blocks[j:]
+			var body []*yaml.Node
+			for i < len(items) && items[i].Line < b.end {
+				body = append(body, items[i])
+				i++
+			}
+			flush()
+			segs = append(segs, c.templateBlockTokens(b, body, inner))
+			continue
+		}
+		run = append(run, items[i])
+		i++
+	}
+	flush()
+	return segs
+}
+
+// templateBlockTokens converts a block and the items inside it.
+func (c *conversion) templateBlockTokens(b *templateBlock, body []*yaml.Node, inner []*templateBlock) []*hclwrite.Token {
+	if b.keyword == "if" {
+		var then, els []*yaml.Node
+		var thenBlocks, elsBlocks []*templateBlock
+		for _, item := range body {
+			if b.els != 0 && item.Line > b.els {
+				els = append(els, item)
+			} else {
+				then = append(then, item)
+			}
+		}
+		for _, ib := range inner {
+			if b.els != 0 && ib.start > b.els {
+				elsBlocks = append(elsBlocks, ib)
+			} else {
+				thenBlocks = append(thenBlocks, ib)
+			}
+		}
+		toks := lexTokens(b.header)
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenQuestion,
+			Bytes: []byte{'?'},
+		})
+		toks = append(toks, c.concatTokens(c.templateSegments(then, thenBlocks, yaml.FlowStyle))...)
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenColon,
+			Bytes: []byte{':'},
+		})
+		return append(toks, c.concatTokens(c.templateSegments(els, elsBlocks, yaml.FlowStyle))...)
+	}
+
+	open := append([]*hclwrite.Token{{
+		Type:  hclsyntax.TokenOBrack,
+		Bytes: []byte{'['},
+	}}, lexTokens("for "+b.header+" :")...)
+	closeBrack := &hclwrite.Token{
+		Type:  hclsyntax.TokenCBrack,
+		Bytes: []byte{']'},
+	}
+	c.depth++
+	defer func() { c.depth-- }()
+	if len(body) == 1 && len(inner) == 0 {
+		item := body[0]
+		toks := commentTokens(item.HeadComment)
+		toks = append(toks, open...)
+		c.startValue("", false)
+		c.lead += len(hclwrite.Tokens(open).Bytes())
+		toks = append(toks, c.yamlIntoTFTokens(item)...)
+		if endsWithHeredoc(toks) {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenNewline,
+				Bytes: []byte{'\n'},
+			})
+		}
+		return append(toks, closeBrack)
+	}
+
+	// With several items each time round, build a tuple of them each time,
+	// and concatenate those. The leading [] keeps concat happy when there
+	// is nothing to repeat.
+	toks := lexTokens("concat([], ")
+	toks = append(toks, open...)
+	toks = append(toks, c.concatTokens(c.templateSegments(body, inner, 0))...)
+	toks = append(toks, closeBrack)
+	return append(toks, lexTokens("...)")...)
+}
+
+// concatTokens joins tuple-valued expressions into one.
+func (c *conversion) concatTokens(segs [][]*hclwrite.Token) []*hclwrite.Token {
+	switch len(segs) {
+	case 0:
+		return lexTokens("[]")
+	case 1:
+		return segs[0]
+	}
+	toks := lexTokens("concat(\n")
+	for i, seg := range segs {
+		toks = append(toks, seg...)
+		if i < len(segs)-1 {
+			toks = append(toks, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte{','},
+			})
+		}
+		toks = append(toks, &hclwrite.Token{
+			Type:  hclsyntax.TokenNewline,
+			Bytes: []byte{'\n'},
+		})
+	}
+	return append(toks, &hclwrite.Token{
+		Type:  hclsyntax.TokenCParen,
+		Bytes: []byte{')'},
+	})
+}
+
+// interpolationTokens returns s as a quoted template, or as a bare expression
+// if it is nothing but one interpolation, like "${name}".
+func interpolationTokens(s string) []*hclwrite.Token {
+	toks := lexTokens(`"` + string(escapeQuotedStringLit(s, true)) + `"`)
+	return terraformfmt.FormatValueExpr(toks)
+}
+
+// templateTokens splits s, a line of a heredoc, into template tokens, so that
+// its interpolations and directives are tokens like those in quoted strings.
+func templateTokens(s string) []*hclwrite.Token {
+	lexed, _ := hclsyntax.LexTemplate([]byte(s), "", hcl.InitialPos)
+	toks := make([]*hclwrite.Token, 0, len(lexed))
+	for _, tok := range lexed {
+		if tok.Type == hclsyntax.TokenEOF {
+			continue
+		}
+		toks = append(toks, &hclwrite.Token{
+			Type:  tok.Type,
+			Bytes: tok.Bytes,
+		})
+	}
+	return toks
+}
+
+// lexTokens splits src, a piece of Terraform expression, into tokens.
+func lexTokens(src string) []*hclwrite.Token {
+	lexed, _ := hclsyntax.LexExpression([]byte(src), "", hcl.InitialPos)
+	toks := make([]*hclwrite.Token, 0, len(lexed))
+	for _, tok := range lexed {
+		if tok.Type == hclsyntax.TokenEOF {
+			continue
+		}
+		toks = append(toks, &hclwrite.Token{
+			Type:  tok.Type,
+			Bytes: tok.Bytes,
+		})
+	}
+	return toks
+}
@@ -0,0 +1,116 @@
+package convert
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertTemplateToTF(t *testing.T, y string, tf string) {
+	t.Helper()
+	out, diags := convertSource([]byte(y), Options{Templates: TemplateFile})
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, tf, string(out))
+}
+
+func TestTemplateFile_interpolations(t *testing.T) {
+	assertTemplateToTF(t, `
+hostname: ${hostname}
+fqdn: ${hostname}.${domain}
+script: |
+  echo ${greeting}
+  %{ for l in lines ~}
+  ${l}
+  %{ endfor ~}
+`, `{
+  hostname = hostname,
+  fqdn     = "${hostname}.${domain}",
+  script   = <<-EOT
+    echo ${greeting}
+    %{for l in lines~}
+    ${l}
+    %{endfor~}
+  EOT
+}`)
+}
+
+func TestTemplateFile_for(t *testing.T) {
+	assertTemplateToTF(t, `
+runcmd:
+  - echo start
+%{ for cmd in commands ~}
+  - ${cmd}
+%{ endfor ~}
+users:
+%{ for u in users ~}
+  - name: ${u.name}
+  - name: ${u.name}-admin
+%{ endfor ~}
+`, `{
+  runcmd = concat(
+    [
+      "echo start",
+    ],
+    [for cmd in commands : cmd]
+  ),
+  users = concat([], [for u in users : [
+    {
+      name = u.name,
+    },
+    {
+      name = "${u.name}-admin",
+    },
+  ]]...),
+}`)
+}
+
+func TestTemplateFile_if(t *testing.T) {
+	assertTemplateToTF(t, `
+packages:
+  - git
+%{ if nginx ~}
+  - nginx
+%{ else ~}
+  - apache2
+%{ endif ~}
+groups:
+  %{ if admin }
+  - sudo
+  %{ endif }
+`, `{
+  packages = concat(
+    [
+      "git",
+    ],
+    nginx ? ["nginx"] : ["apache2"]
+  ),
+  groups = admin ? ["sudo"] : [],
+}`)
+}
+
+func TestTemplateFile_diagnostics(t *testing.T) {
+	_, diags := convertSource([]byte(`a: 1
+%{ if x }
+b: 2
+%{ endif }
+l:
+%{ for x in }
+  - 1
+%{ endfor }
+  - 2
+%{ endif }
+%{ for y in ys }
+  - 3
+`), Options{Templates: TemplateFile})
+	summaries := []string{}
+	for _, d := range diags {
+		summaries = append(summaries, fmt.Sprintf("%d: %s", d.Subject.Start.Line, d.Summary))
+	}
+	assert.ElementsMatch(t, []string{
+		"2: Unsupported template directive",
+		"6: Invalid template directive",
+		"10: Unexpected template directive",
+		"11: Unterminated template directive",
+	}, summaries)
+}
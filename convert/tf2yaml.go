@@ -0,0 +1,1014 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// Converting back from Terraform to YAML walks the tokens of a value, as
+// yamlIntoTFTokens writes them, rather than its syntax tree, since only the
+// tokens have the comments. Anything yaml2tf wouldn't have written, like a
+// reference to a variable, is reported as unsupported.
+
+// tfValue is a value found in a Terraform file, ready to convert back.
+type tfValue struct {
+	// name is what the value is called, for picking one with -name.
+	name string
+	// desc describes where the value came from, for messages.
+	desc string
+	expr hclsyntax.Expression
+	// aliased is whether this is a local value that other values refer to,
+	// which makes it part of them rather than a value of its own.
+	aliased bool
+}
+
+// ToYAML converts the Terraform value in src back into YAML. src can be a
+// bare expression, as -target=expr writes, or a file with the value in it: a
+// local value, a variable's default, an output's value or a top-level
+// attribute, as the other targets write. name picks the value if there are
+// several; without one, every kubernetes_manifest resource's manifest becomes
+// a document of its own.
+func ToYAML(src []byte, filename, name string) ([]byte, hcl.Diagnostics) {
+	p := &tfParser{
+		src:      src,
+		filename: filename,
+		locals:   map[string]hclsyntax.Tokens{},
+		anchors:  map[string]*yaml.Node{},
+		hoisting: map[string]bool{},
+	}
+	var docs []*yaml.Node
+	_, exprDiags := hclsyntax.ParseExpression(src, filename, hcl.InitialPos)
+	if !exprDiags.HasErrors() {
+		toks, _ := hclsyntax.LexExpression(src, filename, hcl.InitialPos)
+		p.toks = toks
+		docs = append(docs, p.document(true))
+	} else {
+		f, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+		if diags.HasErrors() {
+			if first, _ := hclsyntax.LexExpression(src, filename, hcl.InitialPos); looksLikeExpression(first) {
+				return nil, exprDiags
+			}
+			return nil, diags
+		}
+		p.fileToks, _ = hclsyntax.LexConfig(src, filename, hcl.InitialPos)
+		values := p.scanValues(f.Body.(*hclsyntax.Body))
+		picked, diags := pickValues(values, name, filename)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, v := range picked {
+			p.toks = p.exprTokens(v.expr)
+			docs = append(docs, p.document(false))
+		}
+	}
+	if p.diags.HasErrors() {
+		return nil, p.diags
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	for _, d := range docs {
+		if err := enc.Encode(d); err != nil {
+			p.diags = append(p.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Can't write YAML",
+				Detail:   err.Error(),
+			})
+			return nil, p.diags
+		}
+	}
+	enc.Close()
+	return buf.Bytes(), p.diags
+}
+
+// looksLikeExpression reports whether toks start the way a bare value would,
+// rather than an attribute or block, to tell which parse errors to report.
+func looksLikeExpression(toks hclsyntax.Tokens) bool {
+	for _, t := range toks {
+		switch t.Type {
+		case hclsyntax.TokenComment, hclsyntax.TokenNewline:
+			continue
+		case hclsyntax.TokenIdent:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// scanValues finds the values in a Terraform file that yaml2tf could have
+// written, recording every local value so that references to them can become
+// aliases again.
+func (p *tfParser) scanValues(body *hclsyntax.Body) []tfValue {
+	var values []tfValue
+	for _, a := range sortedAttributes(body.Attributes) {
+		values = append(values, tfValue{name: a.Name, desc: "attribute " + a.Name, expr: a.Expr})
+	}
+	for _, b := range body.Blocks {
+		switch {
+		case b.Type == "locals":
+			for _, a := range sortedAttributes(b.Body.Attributes) {
+				p.locals[a.Name] = p.exprTokens(a.Expr)
+				values = append(values, tfValue{name: a.Name, desc: "local." + a.Name, expr: a.Expr})
+			}
+		case b.Type == "variable" && len(b.Labels) == 1:
+			if a := b.Body.Attributes["default"]; a != nil {
+				values = append(values, tfValue{name: b.Labels[0], desc: "var." + b.Labels[0], expr: a.Expr})
+			}
+		case b.Type == "output" && len(b.Labels) == 1:
+			if a := b.Body.Attributes["value"]; a != nil {
+				values = append(values, tfValue{name: b.Labels[0], desc: "output." + b.Labels[0], expr: a.Expr})
+			}
+		case b.Type == "resource" && len(b.Labels) == 2 && b.Labels[0] == "kubernetes_manifest":
+			if a := b.Body.Attributes["manifest"]; a != nil {
+				values = append(values, tfValue{name: b.Labels[1], desc: "kubernetes_manifest." + b.Labels[1], expr: a.Expr})
+			}
+		}
+	}
+
+	referenced := map[string]bool{}
+	for _, v := range values {
+		for _, t := range v.expr.Variables() {
+			if t.RootName() != "local" || len(t) < 2 {
+				continue
+			}
+			if attr, ok := t[1].(hcl.TraverseAttr); ok {
+				referenced[attr.Name] = true
+			}
+		}
+	}
+	for i, v := range values {
+		values[i].aliased = strings.HasPrefix(v.desc, "local.") && referenced[v.name]
+	}
+	return values
+}
+
+// sortedAttributes returns attrs in source order.
+func sortedAttributes(attrs hclsyntax.Attributes) []*hclsyntax.Attribute {
+	sorted := make([]*hclsyntax.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		sorted = append(sorted, a)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].SrcRange.Start.Byte < sorted[j].SrcRange.Start.Byte
+	})
+	return sorted
+}
+
+// pickValues picks the values to convert: the one called name, if given, or
+// else the only one there is that isn't aliased, or every kubernetes_manifest
+// resource.
+func pickValues(values []tfValue, name, filename string) ([]tfValue, hcl.Diagnostics) {
+	if name != "" {
+		for _, v := range values {
+			if v.name == name {
+				return []tfValue{v}, nil
+			}
+		}
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Value not found",
+			Detail:   fmt.Sprintf("There is no value called %q in %s.", name, filename),
+		}}
+	}
+	standalone := values[:0:0]
+	for _, v := range values {
+		if !v.aliased {
+			standalone = append(standalone, v)
+		}
+	}
+	values = standalone
+	if len(values) == 1 {
+		return values, nil
+	}
+	manifests := true
+	descs := make([]string, len(values))
+	for i, v := range values {
+		manifests = manifests && strings.HasPrefix(v.desc, "kubernetes_manifest.")
+		descs[i] = v.desc
+	}
+	if manifests && len(values) > 0 {
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "No value found",
+			Detail:   fmt.Sprintf("%s has no local value, variable default, output value or attribute to convert.", filename),
+		}}
+	}
+	return nil, hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  "Several values found",
+		Detail:   fmt.Sprintf("%s has several values that could be converted: %s. Use -name to pick one.", filename, strings.Join(descs, ", ")),
+	}}
+}
+
+// tfParser builds YAML nodes from the tokens of a Terraform value.
+type tfParser struct {
+	src      []byte
+	filename string
+
+	// toks are the tokens of the value being converted, and pos is the next
+	// one to look at.
+	toks hclsyntax.Tokens
+	pos  int
+	// fileToks are all the tokens of the file the value is in, if any.
+	fileToks hclsyntax.Tokens
+
+	// locals are the tokens of each local value in the file, which are
+	// converted where they are first referred to, and anchored there for
+	// later references to alias. hoisting is the set being converted, to
+	// catch locals that refer to themselves.
+	locals   map[string]hclsyntax.Tokens
+	anchors  map[string]*yaml.Node
+	hoisting map[string]bool
+
+	diags hcl.Diagnostics
+}
+
+// errorf records an error diagnostic about the source range rng.
+func (p *tfParser) errorf(rng hcl.Range, summary string, detail string, args ...any) {
+	p.diags = append(p.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  rng.Ptr(),
+	})
+}
+
+// exprTokens returns the tokens of expr from the file, along with any comment
+// after it on the same line.
+func (p *tfParser) exprTokens(expr hclsyntax.Expression) hclsyntax.Tokens {
+	rng := expr.Range()
+	var toks hclsyntax.Tokens
+	for i, t := range p.fileToks {
+		if t.Range.Start.Byte < rng.Start.Byte {
+			continue
+		}
+		if t.Range.End.Byte > rng.End.Byte {
+			if t.Type == hclsyntax.TokenComment && i > 0 && t.Range.Start.Line == p.fileToks[i-1].Range.End.Line {
+				toks = append(toks, t)
+			}
+			break
+		}
+		toks = append(toks, t)
+	}
+	return append(toks, hclsyntax.Token{
+		Type:  hclsyntax.TokenEOF,
+		Range: hcl.Range{Filename: rng.Filename, Start: rng.End, End: rng.End},
+	})
+}
+
+func (p *tfParser) peek() hclsyntax.Token {
+	if p.pos >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos]
+}
+
+func (p *tfParser) next() hclsyntax.Token {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+// skipNewlines skips newlines and comments, where neither can be kept, like
+// between the arguments of a function call.
+func (p *tfParser) skipNewlines() {
+	for p.peek().Type == hclsyntax.TokenNewline || p.peek().Type == hclsyntax.TokenComment && styleComment(p.peek()) == "" {
+		p.next()
+	}
+}
+
+// expect consumes a token of type typ, or reports an error and returns false.
+func (p *tfParser) expect(typ hclsyntax.TokenType, what string) bool {
+	p.skipNewlines()
+	t := p.peek()
+	if t.Type != typ {
+		p.errorf(t.Range, "Unsupported expression", "Expected %s here.", what)
+		return false
+	}
+	p.next()
+	return true
+}
+
+// document converts a whole value into a YAML document. For a bare
+// expression, which yaml2tf writes with the document's comments around it,
+// the comments before and after the value are the document's.
+func (p *tfParser) document(bare bool) *yaml.Node {
+	p.pos = 0
+	d := &yaml.Node{Kind: yaml.DocumentNode}
+	before := p.comments(true)
+	if bare {
+		d.HeadComment = strings.Join(before.groups, "\n\n")
+	}
+	var v *yaml.Node
+	if isCall(p.toks[p.pos:], "yamlencode") || isCall(p.toks[p.pos:], "jsonencode") {
+		// -encode wraps the value in a call to encode it, which is just
+		// what writing it out as YAML does.
+		p.next()
+		p.next()
+		p.skipNewlines()
+		v = p.value()
+		p.expect(hclsyntax.TokenCParen, "the end of the call")
+	} else if p.isCloudConfig() {
+		v = p.value()
+		p.expect(hclsyntax.TokenCParen, "the end of the call")
+		p.expect(hclsyntax.TokenTemplateSeqEnd, "the end of the interpolation")
+		p.expect(hclsyntax.TokenCQuote, "the end of the string")
+		// cloud-init wants this first, and it's usually right above the
+		// first key.
+		switch {
+		case strings.HasPrefix(d.HeadComment, "#cloud-config"):
+		case v.Kind == yaml.MappingNode && len(v.Content) > 0 && d.HeadComment == "":
+			if !strings.HasPrefix(v.Content[0].HeadComment, "#cloud-config") {
+				v.Content[0].HeadComment = joinComments("#cloud-config", v.Content[0].HeadComment)
+			}
+		default:
+			d.HeadComment = joinComments("#cloud-config", d.HeadComment)
+		}
+	} else {
+		v = p.value()
+	}
+	if lc := p.lineComment(); lc != "" {
+		v.LineComment = joinComments(v.LineComment, lc)
+	}
+	after := p.comments(false)
+	if bare {
+		d.FootComment = strings.Join(after.groups, "\n\n")
+	}
+	if t := p.peek(); t.Type != hclsyntax.TokenEOF {
+		p.errorf(t.Range, "Unsupported expression", "Expected the end of the value here.")
+	}
+	d.Content = []*yaml.Node{v}
+	return d
+}
+
+// isCloudConfig reports whether the next tokens start a string as
+// -encode=cloud-config writes it, "#cloud-config\n${yamlencode(...)}", and if
+// so, consumes them up to the value.
+func (p *tfParser) isCloudConfig() bool {
+	toks := p.toks[p.pos:]
+	if len(toks) < 5 || toks[0].Type != hclsyntax.TokenOQuote ||
+		toks[1].Type != hclsyntax.TokenQuotedLit || string(toks[1].Bytes) != `#cloud-config\n` ||
+		toks[2].Type != hclsyntax.TokenTemplateInterp || !isCall(toks[3:], "yamlencode") {
+		return false
+	}
+	p.pos += 5
+	p.skipNewlines()
+	return true
+}
+
+// isCall reports whether toks start with a call to the function fn.
+func isCall(toks hclsyntax.Tokens, fn string) bool {
+	return len(toks) > 1 && toks[0].Type == hclsyntax.TokenIdent && string(toks[0].Bytes) == fn && toks[1].Type == hclsyntax.TokenOParen
+}
+
+// commentGroups are the comments between two values, in groups separated by
+// blank lines.
+type commentGroups struct {
+	groups []string
+	// blankBefore and blankAfter are whether there is a blank line before
+	// the first group and after the last.
+	blankBefore, blankAfter bool
+}
+
+// comments consumes the newlines and comments up to the next value, or the
+// end of a collection. lineStart is whether the last token consumed ended its
+// line, so that the next newline is a blank line.
+func (p *tfParser) comments(lineStart bool) commentGroups {
+	var cg commentGroups
+	var cur []string
+	blank := false
+	for {
+		t := p.peek()
+		switch {
+		case t.Type == hclsyntax.TokenNewline:
+			if lineStart {
+				if len(cur) > 0 {
+					cg.groups = append(cg.groups, strings.Join(cur, "\n"))
+					cur = nil
+				}
+				blank = true
+			}
+			lineStart = true
+		case t.Type == hclsyntax.TokenComment && styleComment(t) == "":
+			if blank && len(cg.groups) == 0 && len(cur) == 0 {
+				cg.blankBefore = true
+			}
+			blank = false
+			cur = append(cur, yamlComment(t))
+			lineStart = bytes.HasSuffix(t.Bytes, []byte{'\n'})
+		default:
+			if len(cur) > 0 {
+				cg.groups = append(cg.groups, strings.Join(cur, "\n"))
+			}
+			cg.blankAfter = blank
+			return cg
+		}
+		p.next()
+	}
+}
+
+// lineComment consumes a comment on the same line as the last token, if there
+// is one.
+func (p *tfParser) lineComment() string {
+	t := p.peek()
+	if p.pos == 0 || t.Type != hclsyntax.TokenComment || styleComment(t) != "" ||
+		t.Range.Start.Line != p.toks[p.pos-1].Range.End.Line {
+		return ""
+	}
+	p.next()
+	return yamlComment(t)
+}
+
+// yamlComment rewrites a Terraform comment as a YAML one.
+func yamlComment(t hclsyntax.Token) string {
+	s := strings.TrimRight(string(t.Bytes), "\r\n")
+	switch {
+	case strings.HasPrefix(s, "//"):
+		return "#" + s[2:]
+	case strings.HasPrefix(s, "/*"):
+		lines := strings.Split(strings.TrimSpace(strings.TrimSuffix(s[2:], "*/")), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("# "+strings.TrimSpace(line), " ")
+		}
+		return strings.Join(lines, "\n")
+	}
+	return s
+}
+
+// styleCommentPattern matches the comments that styleTokens writes.
+var styleCommentPattern = regexp.MustCompile(`^/\* yaml:(single|double|folded) \*/$`)
+
+// styleComment returns the style that t records, if it is a comment written
+// by styleTokens.
+func styleComment(t hclsyntax.Token) string {
+	if t.Type != hclsyntax.TokenComment {
+		return ""
+	}
+	m := styleCommentPattern.FindSubmatch(t.Bytes)
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
+
+// nodeStyle returns the yaml.Style for a style recorded by styleTokens.
+func nodeStyle(style string) yaml.Style {
+	switch style {
+	case "single":
+		return yaml.SingleQuotedStyle
+	case "double":
+		return yaml.DoubleQuotedStyle
+	case "folded":
+		return yaml.FoldedStyle
+	}
+	return 0
+}
+
+// value converts the value at the current token.
+func (p *tfParser) value() *yaml.Node {
+	style := ""
+	if s := styleComment(p.peek()); s != "" {
+		style = s
+		p.next()
+	}
+	t := p.peek()
+	switch t.Type {
+	case hclsyntax.TokenOBrace:
+		return p.object()
+	case hclsyntax.TokenOBrack:
+		return p.tuple()
+	case hclsyntax.TokenOQuote:
+		s, ok := p.quoted()
+		if !ok {
+			return nullNode()
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: nodeStyle(style)}
+	case hclsyntax.TokenOHeredoc:
+		s, ok := p.heredoc()
+		if !ok {
+			return nullNode()
+		}
+		return heredocNode(s, style)
+	case hclsyntax.TokenNumberLit:
+		p.next()
+		return numberNode(string(t.Bytes))
+	case hclsyntax.TokenMinus:
+		p.next()
+		if n := p.peek(); n.Type == hclsyntax.TokenNumberLit {
+			p.next()
+			return numberNode("-" + string(n.Bytes))
+		}
+	case hclsyntax.TokenIdent:
+		switch name := string(t.Bytes); {
+		case name == "true" || name == "false":
+			p.next()
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: name}
+		case name == "null":
+			p.next()
+			return nullNode()
+		case name == "local" && p.pos+2 < len(p.toks) && p.toks[p.pos+1].Type == hclsyntax.TokenDot:
+			p.next()
+			p.next()
+			return p.localRef(p.next())
+		case isCall(p.toks[p.pos:], "chomp"):
+			p.next()
+			p.next()
+			p.skipNewlines()
+			if a := p.peek(); a.Type != hclsyntax.TokenOQuote && a.Type != hclsyntax.TokenOHeredoc {
+				p.errorf(a.Range, "Unsupported expression", "Only a string or heredoc can be chomped in YAML.")
+				p.skipExpression()
+				p.expect(hclsyntax.TokenCParen, "the end of the call")
+				return nullNode()
+			}
+			v := p.value()
+			p.expect(hclsyntax.TokenCParen, "the end of the call")
+			if v.Kind == yaml.ScalarNode && v.Tag == "!!str" {
+				v.Value = strings.TrimRight(v.Value, "\r\n")
+				if style == "folded" && v.Style == yaml.LiteralStyle {
+					// The style comment goes before the call.
+					v.Style = yaml.FoldedStyle
+				}
+			}
+			return v
+		case isCall(p.toks[p.pos:], "tonumber"):
+			p.next()
+			p.next()
+			p.skipNewlines()
+			s := p.next()
+			if s.Type == hclsyntax.TokenOQuote && p.peek().Type == hclsyntax.TokenQuotedLit {
+				lit := p.next()
+				if !p.expect(hclsyntax.TokenCQuote, "the end of the string") || !p.expect(hclsyntax.TokenCParen, "the end of the call") {
+					return nullNode()
+				}
+				n, err := cty.ParseNumberVal(string(lit.Bytes))
+				switch {
+				case err != nil:
+					p.errorf(lit.Range, "Unsupported expression", "%q isn't a number, so tonumber would fail on it.", lit.Bytes)
+					return nullNode()
+				case n.RawEquals(cty.PositiveInfinity):
+					return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: ".inf"}
+				case n.RawEquals(cty.NegativeInfinity):
+					return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: "-.inf"}
+				}
+				return numberNode(string(lit.Bytes))
+			}
+		case isCall(p.toks[p.pos:], "merge"):
+			return p.merge()
+		}
+	}
+	p.errorf(t.Range, "Unsupported expression", "Only literal values, and the function calls and references that yaml2tf writes, can be converted to YAML.")
+	p.skipExpression()
+	return nullNode()
+}
+
+// skipExpression skips the rest of an expression that can't be converted, up
+// to the end of its attribute or element.
+func (p *tfParser) skipExpression() {
+	depth := 0
+	for {
+		switch p.peek().Type {
+		case hclsyntax.TokenEOF:
+			return
+		case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack, hclsyntax.TokenOParen,
+			hclsyntax.TokenOQuote, hclsyntax.TokenOHeredoc, hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			depth++
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack, hclsyntax.TokenCParen,
+			hclsyntax.TokenCQuote, hclsyntax.TokenCHeredoc, hclsyntax.TokenTemplateSeqEnd:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case hclsyntax.TokenComma, hclsyntax.TokenNewline:
+			if depth == 0 {
+				return
+			}
+		}
+		p.next()
+	}
+}
+
+func nullNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
+
+func numberNode(s string) *yaml.Node {
+	tag := "!!int"
+	if strings.ContainsAny(s, ".eE") {
+		tag = "!!float"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: s}
+}
+
+// heredocNode returns a block scalar for the content of a heredoc. Literal is
+// what yaml2tf assumes without a style comment.
+func heredocNode(s, style string) *yaml.Node {
+	y := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: yaml.LiteralStyle}
+	if style == "folded" {
+		y.Style = yaml.FoldedStyle
+	}
+	return y
+}
+
+// object converts an object literal into a mapping, with the comments around
+// each attribute.
+func (p *tfParser) object() *yaml.Node {
+	open := p.next()
+	m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: open.Range.Start.Line}
+	m.LineComment = p.lineComment()
+	if p.isFor() {
+		return nullNode()
+	}
+	lineStart := m.LineComment != ""
+	var prev *yaml.Node
+	for {
+		cg := p.comments(lineStart)
+		if t := p.peek(); t.Type == hclsyntax.TokenCBrace || t.Type == hclsyntax.TokenEOF {
+			p.footComments(prev, m, cg.groups)
+			p.expect(hclsyntax.TokenCBrace, "the end of the object")
+			break
+		}
+		head := p.splitFootComment(prev, cg)
+
+		k, ok := p.key()
+		if ok {
+			if t := p.peek(); t.Type == hclsyntax.TokenEqual || t.Type == hclsyntax.TokenColon {
+				p.next()
+			} else {
+				p.errorf(t.Range, "Unsupported expression", "Expected an equals sign here.")
+				ok = false
+			}
+		}
+		if !ok {
+			p.skipExpression()
+			if p.peek().Type == hclsyntax.TokenComma {
+				p.next()
+			}
+			lineStart = false
+			continue
+		}
+		k.HeadComment = strings.Join(head, "\n\n")
+		v := p.value()
+		if v.Kind != yaml.ScalarNode && v.LineComment != "" {
+			// yaml.v3 keeps a comment after a key with a collection value
+			// on the key.
+			k.LineComment, v.LineComment = v.LineComment, ""
+		}
+		prev = p.itemEnd(v, k)
+		lineStart = p.atLineStart()
+		m.Content = append(m.Content, k, v)
+	}
+	if len(m.Content) > 0 && m.Line == p.toks[p.pos-1].Range.End.Line {
+		m.Style = yaml.FlowStyle
+	}
+	return m
+}
+
+// tuple converts a tuple literal into a sequence, with the comments around
+// each element.
+func (p *tfParser) tuple() *yaml.Node {
+	open := p.next()
+	s := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: open.Range.Start.Line}
+	s.LineComment = p.lineComment()
+	if p.isFor() {
+		return nullNode()
+	}
+	lineStart := s.LineComment != ""
+	var prev *yaml.Node
+	for {
+		cg := p.comments(lineStart)
+		if t := p.peek(); t.Type == hclsyntax.TokenCBrack || t.Type == hclsyntax.TokenEOF {
+			p.footComments(prev, s, cg.groups)
+			p.expect(hclsyntax.TokenCBrack, "the end of the tuple")
+			break
+		}
+		head := p.splitFootComment(prev, cg)
+		v := p.value()
+		v.HeadComment = joinComments(strings.Join(head, "\n\n"), v.HeadComment)
+		prev = p.itemEnd(v, v)
+		lineStart = p.atLineStart()
+		s.Content = append(s.Content, v)
+	}
+	if len(s.Content) > 0 && s.Line == p.toks[p.pos-1].Range.End.Line {
+		s.Style = yaml.FlowStyle
+	}
+	return s
+}
+
+// atLineStart reports whether the last token consumed ended its line, which
+// only comments do.
+func (p *tfParser) atLineStart() bool {
+	return p.pos > 0 && bytes.HasSuffix(p.toks[p.pos-1].Bytes, []byte{'\n'})
+}
+
+// isFor reports a for expression at the start of a collection, which is
+// where a templatefile's directives went, but can't go back to YAML.
+func (p *tfParser) isFor() bool {
+	i := p.pos
+	for i < len(p.toks)-1 && p.toks[i].Type == hclsyntax.TokenNewline {
+		i++
+	}
+	t := p.toks[i]
+	if t.Type != hclsyntax.TokenIdent || string(t.Bytes) != "for" {
+		return false
+	}
+	p.errorf(t.Range, "Unsupported expression", "A for expression has no YAML equivalent.")
+	depth := 1
+	for depth > 0 && p.peek().Type != hclsyntax.TokenEOF {
+		switch p.next().Type {
+		case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack:
+			depth++
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack:
+			depth--
+		}
+	}
+	return true
+}
+
+// itemEnd consumes the comma after an attribute or element, and a comment
+// after that, which goes on the value if it is a scalar and at the foot of
+// key otherwise. It returns the node that comments after the item belong to.
+func (p *tfParser) itemEnd(v, key *yaml.Node) *yaml.Node {
+	i := p.pos
+	for i < len(p.toks)-1 && p.toks[i].Type == hclsyntax.TokenNewline {
+		// After a heredoc, the comma is on the next line.
+		i++
+	}
+	if p.toks[i].Type == hclsyntax.TokenComma {
+		p.pos = i + 1
+	}
+	if lc := p.lineComment(); lc != "" {
+		if v.Kind == yaml.ScalarNode && v.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 || v.Kind == yaml.AliasNode {
+			v.LineComment = joinComments(v.LineComment, lc)
+		} else {
+			key.FootComment = joinComments(key.FootComment, lc)
+		}
+	}
+	return key
+}
+
+// splitFootComment takes the comments before an item apart: a group right
+// after the previous item, with a blank line before the next, is the previous
+// item's foot comment, and the rest are the next item's head comment.
+func (p *tfParser) splitFootComment(prev *yaml.Node, cg commentGroups) []string {
+	head := cg.groups
+	if prev != nil && len(head) > 0 && !cg.blankBefore && (len(head) > 1 || cg.blankAfter) {
+		prev.FootComment = joinComments(prev.FootComment, head[0])
+		head = head[1:]
+	}
+	return head
+}
+
+// footComments puts the comments at the end of a collection at the foot of
+// its last item, or of the collection itself if it is empty.
+func (p *tfParser) footComments(prev, collection *yaml.Node, groups []string) {
+	if len(groups) == 0 {
+		return
+	}
+	if prev == nil {
+		prev = collection
+	}
+	prev.FootComment = joinComments(prev.FootComment, strings.Join(groups, "\n\n"))
+}
+
+// key converts an object key. Keys that had to be quoted in Terraform don't
+// need to be in YAML, unless a style comment says they were.
+func (p *tfParser) key() (*yaml.Node, bool) {
+	style := ""
+	if s := styleComment(p.peek()); s != "" {
+		style = s
+		p.next()
+	}
+	t := p.peek()
+	switch t.Type {
+	case hclsyntax.TokenIdent:
+		p.next()
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(t.Bytes)}, true
+	case hclsyntax.TokenOQuote:
+		s, ok := p.quoted()
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: nodeStyle(style)}, ok
+	}
+	p.errorf(t.Range, "Unsupported expression", "Expected an attribute name here.")
+	return nil, false
+}
+
+// quoted returns the value of a quoted string. Escape sequences are decoded,
+// but template sequences are kept as they are, since they mean nothing to
+// YAML.
+func (p *tfParser) quoted() (string, bool) {
+	open := p.next()
+	b := strings.Builder{}
+	for {
+		t := p.peek()
+		switch t.Type {
+		case hclsyntax.TokenQuotedLit:
+			p.next()
+			s, err := unescapeQuotedLit(t.Bytes)
+			if err != nil {
+				p.errorf(t.Range, "Invalid string", "Can't decode the escape sequences in this string.")
+				return "", false
+			}
+			b.WriteString(s)
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			b.Write(p.templateSequence())
+		case hclsyntax.TokenCQuote:
+			p.next()
+			return b.String(), true
+		default:
+			p.errorf(hcl.RangeBetween(open.Range, t.Range), "Invalid string", "This string isn't terminated.")
+			return "", false
+		}
+	}
+}
+
+// unescapeQuotedLit decodes the escape sequences in a literal part of a quoted
+// string, the reverse of escapeQuotedStringLit.
+func unescapeQuotedLit(lit []byte) (string, error) {
+	switch string(lit) {
+	case "$${":
+		return "${", nil
+	case "%%{":
+		return "%{", nil
+	}
+	if !bytes.ContainsRune(lit, '\\') {
+		return string(lit), nil
+	}
+	// Terraform's escapes are a subset of Go's.
+	return strconv.Unquote(`"` + string(lit) + `"`)
+}
+
+// templateSequence consumes an interpolation or directive, returning it as it
+// was written.
+func (p *tfParser) templateSequence() []byte {
+	start := p.next()
+	end := start
+	depth := 1
+	for depth > 0 && p.peek().Type != hclsyntax.TokenEOF {
+		end = p.next()
+		switch end.Type {
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			depth++
+		case hclsyntax.TokenTemplateSeqEnd:
+			depth--
+		}
+	}
+	return p.src[start.Range.Start.Byte:end.Range.End.Byte]
+}
+
+// heredoc returns the content of a heredoc, with the indentation of an
+// indented (<<-) heredoc removed.
+func (p *tfParser) heredoc() (string, bool) {
+	open := p.next()
+	b := strings.Builder{}
+	for {
+		t := p.peek()
+		switch t.Type {
+		case hclsyntax.TokenStringLit:
+			p.next()
+			switch string(t.Bytes) {
+			case "$${":
+				b.WriteString("${")
+			case "%%{":
+				b.WriteString("%{")
+			default:
+				b.Write(t.Bytes)
+			}
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			b.Write(p.templateSequence())
+		case hclsyntax.TokenCHeredoc:
+			p.next()
+			if bytes.HasPrefix(open.Bytes, []byte("<<-")) {
+				return unindentHeredoc(b.String()), true
+			}
+			return b.String(), true
+		default:
+			p.errorf(hcl.RangeBetween(open.Range, t.Range), "Invalid heredoc", "This heredoc isn't terminated.")
+			return "", false
+		}
+	}
+}
+
+// unindentHeredoc strips the indentation from the content of a <<- heredoc the
+// way Terraform does: the least any line is indented by, ignoring lines with
+// nothing but whitespace, is removed from every line but those.
+func unindentHeredoc(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	least := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		if trimmed == "" {
+			continue
+		}
+		n := utf8.RuneCountInString(line[:len(line)-len(trimmed)])
+		if least < 0 || n < least {
+			least = n
+		}
+	}
+	for i, line := range lines {
+		if strings.TrimLeftFunc(line, unicode.IsSpace) == "" {
+			continue
+		}
+		lines[i] = string([]rune(line)[least:])
+	}
+	return strings.Join(lines, "")
+}
+
+// localRef converts a reference to a local value: the first one becomes the
+// local's value, anchored with its name, and the rest become aliases to it.
+func (p *tfParser) localRef(name hclsyntax.Token) *yaml.Node {
+	n := string(name.Bytes)
+	if a, ok := p.anchors[n]; ok {
+		return &yaml.Node{Kind: yaml.AliasNode, Value: n, Alias: a}
+	}
+	toks, ok := p.locals[n]
+	if !ok {
+		p.errorf(name.Range, "Unsupported expression", "There is no local value called %q in this file to convert.", n)
+		return nullNode()
+	}
+	if p.hoisting[n] {
+		p.errorf(name.Range, "Unsupported expression", "The local value %q refers to itself, which YAML can't represent.", n)
+		return nullNode()
+	}
+	p.hoisting[n] = true
+	saved, savedPos := p.toks, p.pos
+	p.toks, p.pos = toks, 0
+	p.skipNewlines()
+	v := p.value()
+	p.toks, p.pos = saved, savedPos
+	delete(p.hoisting, n)
+
+	v.Anchor = n
+	p.anchors[n] = v
+	return v
+}
+
+// merge converts a call to merge(), as mergeTokens writes it, into a mapping
+// with a merge key: the mappings merged, in YAML's order of precedence, and
+// then the entries of the last argument, if it's an object.
+func (p *tfParser) merge() *yaml.Node {
+	call := p.next()
+	p.next()
+	var args []*yaml.Node
+	for {
+		p.skipNewlines()
+		if p.peek().Type == hclsyntax.TokenCParen {
+			p.next()
+			break
+		}
+		args = append(args, p.value())
+		p.skipNewlines()
+		if p.peek().Type == hclsyntax.TokenComma {
+			p.next()
+		} else if !p.expect(hclsyntax.TokenCParen, "a comma or the end of the call") {
+			return nullNode()
+		} else {
+			break
+		}
+	}
+
+	m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if n := len(args); n > 0 && args[n-1].Kind == yaml.MappingNode && args[n-1].Anchor == "" {
+		m.Content = args[n-1].Content
+		args = args[:n-1]
+	}
+	merges := make([]*yaml.Node, 0, len(args))
+	for i := len(args) - 1; i >= 0; i-- {
+		a := args[i]
+		target := a
+		if a.Kind == yaml.AliasNode {
+			target = a.Alias
+		}
+		if target.Kind != yaml.MappingNode {
+			p.errorf(call.Range, "Unsupported expression", "Only objects can be merged in YAML.")
+			return nullNode()
+		}
+		merges = append(merges, a)
+	}
+	if len(merges) == 0 {
+		return m
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: "<<"}
+	value := merges[0]
+	if len(merges) > 1 {
+		value = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle, Content: merges}
+	}
+	m.Content = append([]*yaml.Node{key, value}, m.Content...)
+	return m
+}
@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertTFToYAML(t *testing.T, name, tf string, y string) {
+	t.Helper()
+	out, diags := ToYAML([]byte(tf), "test.tf", name)
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, y, string(out))
+}
+
+// assertRoundTrip converts y to Terraform with opts, and checks that it
+// converts back to the same YAML.
+func assertRoundTrip(t *testing.T, opts Options, y string) {
+	t.Helper()
+	tf, diags := convertSource([]byte(y), opts)
+	require.False(t, diags.HasErrors(), diags.Error())
+	assertTFToYAML(t, "", string(tf), y)
+}
+
+func TestTFToYAML_roundTrip(t *testing.T) {
+	assertRoundTrip(t, Options{PreserveStyle: true}, `# head
+
+# about a
+a: 1 # one
+b:
+  c: "quoted"
+  d: 'single'
+  # before e
+  e: [1, 2]
+list:
+  - x # x comment
+  - y
+  # foot of y
+
+  # head of z
+  - z
+script: |
+  echo ${HOME}
+  echo hi
+folded: >-
+  some folded text
+strip: |-
+  no newline
+empty: {}
+n: null
+inf: -.inf
+s: "1"
+# end of file
+`)
+}
+
+func TestTFToYAML_aliases(t *testing.T) {
+	assertRoundTrip(t, Options{Aliases: AliasLocals, Target: TargetLocals}, `defaults: &defaults
+  image: nginx
+web:
+  <<: *defaults
+  image: httpd
+worker:
+  <<: [*defaults, {image: busybox}]
+scripts:
+  - |
+    echo one
+  - |-
+    echo two
+`)
+}
+
+func TestTFToYAML_targets(t *testing.T) {
+	const y = "a: 1 # one\nb: [x]\n"
+	for _, target := range []TargetMode{TargetVariable, TargetOutput, TargetTFVars} {
+		assertRoundTrip(t, Options{Target: target}, y)
+	}
+	assertRoundTrip(t, Options{Encode: EncodeJSON}, y)
+	assertRoundTrip(t, Options{Encode: EncodeCloudConfig}, "#cloud-config\npackages: [git]\n")
+
+	assertRoundTrip(t, Options{Target: TargetKubernetesManifest}, `kind: Namespace
+metadata:
+  name: prod
+---
+kind: ConfigMap
+metadata:
+  name: app # the app
+  namespace: prod
+`)
+}
+
+func TestTFToYAML_name(t *testing.T) {
+	const tf = `
+locals {
+  a = { x = 1 }
+}
+
+output "b" {
+  value = [local.a, local.a]
+}
+`
+	assertTFToYAML(t, "a", tf, "{x: 1}\n")
+	assertTFToYAML(t, "b", tf, "[&a {x: 1}, *a]\n")
+
+	_, diags := ToYAML([]byte(tf+"variable \"c\" {\n  default = 1\n}\n"), "test.tf", "")
+	require.True(t, diags.HasErrors())
+	assert.Equal(t, "Several values found", diags[0].Summary)
+	assert.Contains(t, diags[0].Detail, "output.b, var.c")
+}
+
+func TestTFToYAML_diagnostics(t *testing.T) {
+	for tf, summary := range map[string]string{
+		"{\n  a = var.x,\n}":                "Unsupported expression",
+		"[for x in y : x]":                  "Unsupported expression",
+		"{\n  a = local.missing\n}":         "Unsupported expression",
+		"{\n  a = \n}":                      "Invalid expression",
+		"locals {\n  a = local.a\n}\n":      "Unsupported expression",
+		"locals {\n  a = merge(1, {})\n}\n": "Unsupported expression",
+		"{\n  a = tonumber(\"x\")\n}":       "Unsupported expression",
+		"{\n  a = chomp(1)\n}":              "Unsupported expression",
+	} {
+		_, diags := ToYAML([]byte(tf), "test.tf", "a")
+		if assert.True(t, diags.HasErrors(), tf) {
+			assert.Equal(t, summary, diags[0].Summary, tf)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"gopkg.in/yaml.v3"
+)
+
+// verifyFunctions are the Terraform functions that yaml2tf writes calls to,
+// implemented the same way Terraform does.
+var verifyFunctions = map[string]function.Function{
+	"chomp":      stdlib.ChompFunc,
+	"concat":     stdlib.ConcatFunc,
+	"merge":      stdlib.MergeFunc,
+	"jsonencode": stdlib.JSONEncodeFunc,
+	"yamlencode": ctyyaml.YAMLEncodeFunc,
+	"tonumber": function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:      "v",
+				Type:      cty.DynamicPseudoType,
+				AllowNull: true,
+			},
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return convert.Convert(args[0], cty.Number)
+		},
+	}),
+}
+
+// verifyYAMLToTF checks that the Terraform that docs convert into with opts
+// evaluates to the same values that Terraform's yamldecode gives for each
+// document, and returns an error for each difference, pointing at the YAML
+// it's in. Differences that opts.Nulls asks for aren't errors.
+func verifyYAMLToTF(docs []*yaml.Node, opts Options) hcl.Diagnostics {
+	c := newConversion(opts)
+	if len(docs) == 0 {
+		return nil
+	}
+	want := make([]cty.Value, len(docs))
+	for i, d := range docs {
+		src, err := yaml.Marshal(untagMergeKeys(d, map[*yaml.Node]*yaml.Node{}))
+		if err == nil {
+			want[i], err = ctyyaml.YAMLDecodeFunc.Call([]cty.Value{cty.StringVal(string(src))})
+		}
+		if err != nil {
+			c.errorf(d, "Can't verify conversion", "Terraform's yamldecode can't decode this document: %s.", err)
+			return c.diags
+		}
+	}
+
+	got, diags := evalConvertedTF(docs, opts)
+	if diags.HasErrors() {
+		for _, diag := range diags {
+			c.errorf(docs[0], "Can't verify conversion", "The converted Terraform can't be evaluated: %s", diag.Error())
+		}
+		return c.diags
+	}
+
+	if len(got) == 1 && len(docs) > 1 {
+		// Several documents converted into a tuple.
+		c.diffValues("", nil, cty.TupleVal(want), got[0])
+		return c.diags
+	}
+	for i, d := range docs {
+		c.diffValues("", d, want[i], got[i])
+	}
+	return c.diags
+}
+
+// untagMergeKeys copies y with the explicit tag removed from merge keys, which
+// yaml.v3 would otherwise write as `!!merge <<`, which yamldecode rejects.
+// copies maps nodes to their copies, so that aliases still point at anchors.
+func untagMergeKeys(y *yaml.Node, copies map[*yaml.Node]*yaml.Node) *yaml.Node {
+	if c, ok := copies[y]; ok {
+		return c
+	}
+	c := *y
+	copies[y] = &c
+	if c.Tag == "!!merge" {
+		c.Tag = ""
+	}
+	if c.Alias != nil {
+		c.Alias = untagMergeKeys(c.Alias, copies)
+	}
+	c.Content = make([]*yaml.Node, len(y.Content))
+	for i, child := range y.Content {
+		c.Content[i] = untagMergeKeys(child, copies)
+	}
+	return &c
+}
+
+// evalConvertedTF converts docs into Terraform with opts, and evaluates it,
+// returning the value it gives for each document, or for all of them as a
+// tuple.
+func evalConvertedTF(docs []*yaml.Node, opts Options) ([]cty.Value, hcl.Diagnostics) {
+	if opts.Target == TargetExpr && opts.Documents == DocumentsTuple {
+		// A bare value and the locals it refers to don't make a valid file,
+		// but the value is the same wherever it goes.
+		opts.Target = TargetLocals
+		opts.Name = "value"
+	}
+	h, diags := yamlDocumentsToTF(docs, opts)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	f, diags := hclsyntax.ParseConfig(h.Bytes(), opts.Filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body := f.Body.(*hclsyntax.Body)
+	ctx := &hcl.EvalContext{Functions: verifyFunctions}
+	locals, diags := evalLocals(body, ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	ctx.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+
+	var exprs []hclsyntax.Expression
+	name := opts.valueName()
+	switch {
+	case opts.Documents == DocumentsLocals:
+		for i := range docs {
+			exprs = append(exprs, localExpr(body, documentName(name, i)))
+		}
+	case opts.Documents == DocumentsKubernetesManifest || opts.Target == TargetKubernetesManifest:
+		for _, b := range body.Blocks {
+			if b.Type == "resource" {
+				exprs = append(exprs, b.Body.Attributes["manifest"].Expr)
+			}
+		}
+	case opts.Target == TargetLocals:
+		exprs = append(exprs, localExpr(body, name))
+	case opts.Target == TargetVariable || opts.Target == TargetOutput:
+		attr := "default"
+		if opts.Target == TargetOutput {
+			attr = "value"
+		}
+		for _, b := range body.Blocks {
+			if len(b.Labels) == 1 && b.Labels[0] == name {
+				exprs = append(exprs, b.Body.Attributes[attr].Expr)
+			}
+		}
+	case opts.Target == TargetTFVars:
+		exprs = append(exprs, body.Attributes[name].Expr)
+	}
+
+	values := make([]cty.Value, len(exprs))
+	for i, expr := range exprs {
+		v, moreDiags := expr.Value(ctx)
+		diags = append(diags, moreDiags...)
+		if !moreDiags.HasErrors() && opts.Encode != EncodeNone {
+			v, moreDiags = decodeEncoded(v, opts.Encode)
+			diags = append(diags, moreDiags...)
+		}
+		values[i] = v
+	}
+	return values, diags
+}
+
+// localExpr returns the expression of the local value called name.
+func localExpr(body *hclsyntax.Body, name string) hclsyntax.Expression {
+	for _, b := range body.Blocks {
+		if b.Type == "locals" && b.Body.Attributes[name] != nil {
+			return b.Body.Attributes[name].Expr
+		}
+	}
+	return nil
+}
+
+// evalLocals evaluates every local value in body, each after the ones it
+// refers to.
+func evalLocals(body *hclsyntax.Body, ctx *hcl.EvalContext) (map[string]cty.Value, hcl.Diagnostics) {
+	var attrs []*hclsyntax.Attribute
+	for _, b := range body.Blocks {
+		if b.Type == "locals" {
+			attrs = append(attrs, sortedAttributes(b.Body.Attributes)...)
+		}
+	}
+	locals := map[string]cty.Value{}
+	for len(attrs) > 0 {
+		var pending []*hclsyntax.Attribute
+		for _, a := range attrs {
+			ready := true
+			for _, t := range a.Expr.Variables() {
+				if t.RootName() != "local" || len(t) < 2 {
+					continue
+				}
+				if attr, ok := t[1].(hcl.TraverseAttr); ok {
+					_, done := locals[attr.Name]
+					ready = ready && done
+				}
+			}
+			if !ready {
+				pending = append(pending, a)
+				continue
+			}
+			v, diags := a.Expr.Value(&hcl.EvalContext{
+				Functions: ctx.Functions,
+				Variables: map[string]cty.Value{"local": cty.ObjectVal(locals)},
+			})
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			locals[a.Name] = v
+		}
+		if len(pending) == len(attrs) {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid local values",
+				Detail:   fmt.Sprintf("The local value %q refers to itself.", pending[0].Name),
+				Subject:  pending[0].SrcRange.Ptr(),
+			}}
+		}
+		attrs = pending
+	}
+	return locals, nil
+}
+
+// decodeEncoded decodes the string that -encode wrapped the value in.
+func decodeEncoded(v cty.Value, m EncodeMode) (cty.Value, hcl.Diagnostics) {
+	s := v.AsString()
+	if m == EncodeCloudConfig {
+		if !strings.HasPrefix(s, "#cloud-config\n") {
+			return cty.NilVal, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid cloud-config",
+				Detail:   "The value doesn't start with #cloud-config.",
+			}}
+		}
+		s = strings.TrimPrefix(s, "#cloud-config\n")
+	}
+	// JSON is YAML too.
+	decoded, err := ctyyaml.YAMLDecodeFunc.Call([]cty.Value{cty.StringVal(s)})
+	if err != nil {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid encoded value",
+			Detail:   err.Error(),
+		}}
+	}
+	return decoded, nil
+}
+
+// diffValues reports the differences between want, the value of the YAML node
+// y at path, and got, the value that Terraform has for it.
+func (c *conversion) diffValues(path string, y *yaml.Node, want, got cty.Value) {
+	if y != nil && y.Kind == yaml.DocumentNode && len(y.Content) > 0 {
+		y = y.Content[0]
+	}
+	if y != nil && y.Kind == yaml.AliasNode {
+		y = y.Alias
+	}
+	mismatch := func(detail string, args ...any) {
+		if y == nil {
+			c.diags = append(c.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Conversion mismatch",
+				Detail:   fmt.Sprintf("At %s, ", describePath(path)) + fmt.Sprintf(detail, args...),
+			})
+			return
+		}
+		c.errorf(y, "Conversion mismatch", "At %s, "+detail, append([]any{describePath(path)}, args...)...)
+	}
+
+	if want.IsNull() {
+		if got.IsNull() || c.isNullReplacement(got) {
+			return
+		}
+		mismatch("YAML has null but Terraform has %s.", describeValue(got))
+		return
+	}
+	if got.IsNull() || valueKind(want) != valueKind(got) {
+		mismatch("YAML has %s but Terraform has %s.", describeValue(want), describeValue(got))
+		return
+	}
+
+	ty := want.Type()
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		wantAttrs, gotAttrs := want.AsValueMap(), got.AsValueMap()
+		for k, w := range wantAttrs {
+			g, ok := gotAttrs[k]
+			child := mappingValue(y, k)
+			if child == nil {
+				child = y
+			}
+			if !ok {
+				if w.IsNull() && c.opts.Nulls == NullOmit {
+					continue
+				}
+				mismatch("Terraform is missing the key %q.", k)
+				continue
+			}
+			c.diffValues(pathKey(path, k), child, w, g)
+		}
+		for k := range gotAttrs {
+			if _, ok := wantAttrs[k]; !ok {
+				mismatch("Terraform has the key %q, which YAML doesn't.", k)
+			}
+		}
+	case ty.IsTupleType() || ty.IsListType():
+		wantElems, gotElems := want.AsValueSlice(), got.AsValueSlice()
+		if len(wantElems) != len(gotElems) {
+			mismatch("YAML has %d elements but Terraform has %d.", len(wantElems), len(gotElems))
+			return
+		}
+		for i := range wantElems {
+			child := y
+			if y != nil && y.Kind == yaml.SequenceNode && i < len(y.Content) {
+				child = y.Content[i]
+			}
+			c.diffValues(fmt.Sprintf("%s[%d]", path, i), child, wantElems[i], gotElems[i])
+		}
+	default:
+		if !want.Equals(got).True() {
+			mismatch("YAML has %s but Terraform has %s.", describeValue(want), describeValue(got))
+		}
+	}
+}
+
+// isNullReplacement reports whether v is what opts.Nulls replaces nulls with.
+func (c *conversion) isNullReplacement(v cty.Value) bool {
+	switch c.opts.Nulls {
+	case NullEmptyString:
+		return v.Type() == cty.String && v.AsString() == ""
+	case NullEmptyTuple:
+		return valueKind(v) == "tuple" && v.LengthInt() == 0
+	case NullEmptyObject:
+		return valueKind(v) == "object" && v.LengthInt() == 0
+	}
+	return false
+}
+
+// valueKind groups types the way YAML would: collections only by whether they
+// are mappings or sequences.
+func valueKind(v cty.Value) string {
+	ty := v.Type()
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		return "object"
+	case ty.IsTupleType() || ty.IsListType() || ty.IsSetType():
+		return "tuple"
+	}
+	return ty.FriendlyName()
+}
+
+// describeValue describes v for messages: primitive values themselves, and
+// only the kind of collections.
+func describeValue(v cty.Value) string {
+	switch {
+	case v.IsNull():
+		return "null"
+	case !v.IsKnown():
+		return "an unknown value"
+	case v.Type() == cty.String:
+		return fmt.Sprintf("the string %q", v.AsString())
+	case v.Type() == cty.Number:
+		return "the number " + v.AsBigFloat().Text('g', -1)
+	case v.Type() == cty.Bool:
+		return fmt.Sprintf("the bool %t", v.True())
+	case valueKind(v) == "object":
+		return "an object"
+	case valueKind(v) == "tuple":
+		return "a tuple"
+	}
+	return v.Type().FriendlyName()
+}
+
+// plainPathKey matches keys that can go in a path without quoting.
+var plainPathKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// pathKey appends the key k to a YAML path, like .a.b[0], in the style of yq.
+func pathKey(path, k string) string {
+	if plainPathKey.MatchString(k) {
+		return path + "." + k
+	}
+	return fmt.Sprintf("%s[%q]", path, k)
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "the top level"
+	}
+	return path
+}
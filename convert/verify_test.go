@@ -0,0 +1,70 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const verifyYAML = `# head
+a: 1
+b:
+  c: [x, 1.5, true, null]
+  d: |
+    text
+  e: |-
+    chomped
+refs:
+  base: &base {image: nginx}
+  web:
+    <<: *base
+    port: 80
+`
+
+func verifyDiagnostics(t *testing.T, opts Options, y string) []string {
+	t.Helper()
+	docs, diags := parseYAML([]byte(y), "test.yaml")
+	require.False(t, diags.HasErrors(), diags.Error())
+	opts.Source = []byte(y)
+	var details []string
+	for _, diag := range verifyYAMLToTF(docs, opts) {
+		details = append(details, diag.Detail)
+	}
+	return details
+}
+
+func TestVerify_equivalent(t *testing.T) {
+	for _, opts := range []Options{
+		{},
+		{Aliases: AliasLocals},
+		{Target: TargetOutput, Name: "value"},
+		{Target: TargetTFVars, Name: "value"},
+		{Encode: EncodeJSON},
+		{Encode: EncodeCloudConfig},
+		{Nulls: NullOmit},
+		{Nulls: NullEmptyString},
+	} {
+		assert.Empty(t, verifyDiagnostics(t, opts, verifyYAML), "%+v", opts)
+	}
+
+	const stream = "a: 1\n---\nb: [x]\n"
+	for _, opts := range []Options{{}, {Documents: DocumentsLocals}, {Target: TargetKubernetesManifest}} {
+		assert.Empty(t, verifyDiagnostics(t, opts, stream), "%+v", opts)
+	}
+}
+
+func TestVerify_mismatch(t *testing.T) {
+	// Terraform's yamldecode follows YAML 1.1 for booleans and timestamps,
+	// where yaml.v3 doesn't.
+	assert.Equal(t, []string{
+		`At .list[1], YAML has the bool true but Terraform has the string "y".`,
+	}, verifyDiagnostics(t, Options{}, "list: [x, y]\n"))
+	assert.Equal(t, []string{
+		`At the top level, Terraform is missing the key "false".`,
+		`At the top level, Terraform has the key "n", which YAML doesn't.`,
+	}, verifyDiagnostics(t, Options{}, "n: 1\n"))
+	assert.Equal(t, []string{
+		`At ["a b"].t, YAML has the string "2001-12-14T21:59:43-05:00" but Terraform has the string "2001-12-14t21:59:43.10-05:00".`,
+	}, verifyDiagnostics(t, Options{}, "a b:\n  t: 2001-12-14t21:59:43.10-05:00\n"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mattn/go-isatty"
+)
+
+// printDiagnostics writes diags to w in the same format as Terraform, with
+// snippets from sources (keyed by filename) where available. They're colored if
+// w is a terminal.
+func printDiagnostics(w io.Writer, diags hcl.Diagnostics, sources map[string][]byte) {
+	if len(diags) == 0 {
+		return
+	}
+	files := map[string]*hcl.File{}
+	for name, src := range sources {
+		files[name] = &hcl.File{Bytes: src}
+	}
+	color := false
+	if f, ok := w.(*os.File); ok {
+		color = isatty.IsTerminal(f.Fd())
+	}
+	wr := hcl.NewDiagnosticTextWriter(w, files, 78, color)
+	wr.WriteDiagnostics(diags)
+}
+
+// diagnosticSources adds to sources each other file that diags refer to, as
+// far as it can be read, so that their snippets can be shown.
+func diagnosticSources(diags hcl.Diagnostics, sources map[string][]byte) map[string][]byte {
+	for _, d := range diags {
+		if d.Subject == nil {
+			continue
+		}
+		if _, ok := sources[d.Subject.Filename]; ok {
+			continue
+		}
+		if src, err := os.ReadFile(d.Subject.Filename); err == nil {
+			sources[d.Subject.Filename] = src
+		}
+	}
+	return sources
+}
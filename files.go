@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// stringsFlag is a flag that can be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// input is a YAML file to convert, and where its Terraform goes.
+type input struct {
+	Path   string
+	Output string
+}
+
+// collectInputs expands the file and directory arguments into the YAML files
+// to convert. Files named explicitly are always converted; files found by
+// walking a directory must match one of the include globs and none of the
+// exclude globs. Globs match either the file's base name or its path relative
+// to the directory argument, with forward slashes.
+//
+// Outputs, with the extension ext, go next to their source unless outDir is
+// set, in which case they keep the same layout relative to the directory they
+// were found in.
+func collectInputs(paths []string, include, exclude []string, outDir, ext string) ([]input, error) {
+	if len(include) == 0 {
+		include = []string{"*.yaml", "*.yml"}
+	}
+	inputs := []input{}
+	outputs := map[string]string{}
+	add := func(path, rel string) error {
+		out := filepath.Join(filepath.Dir(path), outputName(path, ext))
+		if outDir != "" {
+			out = filepath.Join(outDir, filepath.Dir(rel), outputName(path, ext))
+		}
+		if other, ok := outputs[out]; ok {
+			return fmt.Errorf("%s and %s would both be converted to %s", other, path, out)
+		}
+		outputs[out] = path
+		inputs = append(inputs, input{Path: path, Output: out})
+		return nil
+	}
+
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := add(root, filepath.Base(root)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && matchesAny(exclude, d.Name(), filepath.ToSlash(rel)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !matchesAny(include, d.Name(), filepath.ToSlash(rel)) || matchesAny(exclude, d.Name(), filepath.ToSlash(rel)) {
+				return nil
+			}
+			return add(path, rel)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inputs, nil
+}
+
+// findFiles expands the file and directory arguments into the files to
+// process: every file named explicitly, and every file with one of exts in
+// each directory, and in its subdirectories if recursive is set.
+func findFiles(paths []string, recursive bool, exts ...string) ([]string, error) {
+	files := []string{}
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path == root || slices.Contains(exts, filepath.Ext(path)) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func matchesAny(globs []string, names ...string) bool {
+	for _, g := range globs {
+		for _, name := range names {
+			if ok, _ := filepath.Match(g, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// outputName is the name of the file that the YAML file at path converts to:
+// its base name with a .yaml or .yml extension replaced by outExt.
+func outputName(path, outExt string) string {
+	name := filepath.Base(path)
+	for _, ext := range []string{".yaml", ".yml"} {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	return name + outExt
+}
+
+// generatedHeader marks files written by yaml2tf. The checksum of the rest of
+// the file lets us tell whether it has been edited since.
+const generatedHeader = "# Code generated by yaml2tf; DO NOT EDIT.\n"
+
+func generatedFile(source string, content []byte) []byte {
+	sum := sha256.Sum256(content)
+	buf := bytes.Buffer{}
+	buf.WriteString(generatedHeader)
+	fmt.Fprintf(&buf, "# source: %s, checksum: sha256:%s\n\n", filepath.ToSlash(source), hex.EncodeToString(sum[:]))
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+var errHandEdited = errors.New("has been edited since it was generated; use -force to overwrite it")
+
+// checkOverwrite returns an error if there's a file at path that we shouldn't
+// overwrite: one that yaml2tf didn't generate, or that has been edited since.
+func checkOverwrite(path string) error {
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rest, ok := bytes.CutPrefix(existing, []byte(generatedHeader))
+	if !ok {
+		return errors.New("was not generated by yaml2tf; use -force to overwrite it")
+	}
+	info, content, ok := bytes.Cut(rest, []byte("\n\n"))
+	_, sum, found := bytes.Cut(info, []byte("checksum: sha256:"))
+	if !ok || !found {
+		return errHandEdited
+	}
+	want := sha256.Sum256(content)
+	if string(sum) != hex.EncodeToString(want[:]) {
+		return errHandEdited
+	}
+	return nil
+}
+
+// outputFile returns the full content of the file at path generated from
+// source, which is referred to relative to it.
+func outputFile(path, source string, content []byte) []byte {
+	if rel, err := filepath.Rel(filepath.Dir(path), source); err == nil {
+		source = rel
+	}
+	return generatedFile(source, content)
+}
+
+// writeOutput writes the generated content for source to path, creating
+// directories as needed, unless checkOverwrite objects and force isn't set.
+func writeOutput(path, source string, content []byte, force bool) error {
+	if !force {
+		if err := checkOverwrite(path); err != nil {
+			return fmt.Errorf("%s %w", path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, outputFile(path, source, content), 0o644)
+}
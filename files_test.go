@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestCollectInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml":             "",
+		"notes.txt":          "",
+		"sub/b.yml":          "",
+		"sub/c.values.yaml":  "",
+		"vendor/d.yaml":      "",
+		"explicit/e.cfg.txt": "",
+	})
+
+	inputs, err := collectInputs([]string{dir, filepath.Join(dir, "explicit/e.cfg.txt")}, nil, []string{"vendor", "*.values.yaml"}, "", ".tf")
+	require.NoError(t, err)
+	assert.Equal(t, []input{
+		{Path: filepath.Join(dir, "a.yaml"), Output: filepath.Join(dir, "a.tf")},
+		{Path: filepath.Join(dir, "sub/b.yml"), Output: filepath.Join(dir, "sub/b.tf")},
+		{Path: filepath.Join(dir, "explicit/e.cfg.txt"), Output: filepath.Join(dir, "explicit/e.cfg.txt.tf")},
+	}, inputs)
+
+	inputs, err = collectInputs([]string{dir}, []string{"sub/*.yaml"}, nil, "out", ".tfvars")
+	require.NoError(t, err)
+	assert.Equal(t, []input{
+		{Path: filepath.Join(dir, "sub/c.values.yaml"), Output: filepath.Join("out", "sub/c.values.tfvars")},
+	}, inputs)
+}
+
+func TestCollectInputs_collision(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": "",
+		"a.yml":  "",
+	})
+	_, err := collectInputs([]string{dir}, nil, nil, "", ".tf")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would both be converted to")
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.yaml")
+	out := filepath.Join(dir, "a.tf")
+
+	require.NoError(t, writeOutput(out, src, []byte("{}\n"), false))
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, `# Code generated by yaml2tf; DO NOT EDIT.
+# source: a.yaml, checksum: sha256:ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356
+
+{}
+`, string(got))
+
+	// Regenerating is fine...
+	require.NoError(t, writeOutput(out, src, []byte("{ a = 1 }\n"), false))
+
+	// ...but not once it has been edited, unless forced.
+	f, err := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	f.WriteString("# my notes\n")
+	f.Close()
+	assert.True(t, errors.Is(writeOutput(out, src, []byte("{}\n"), false), errHandEdited))
+	assert.NoError(t, writeOutput(out, src, []byte("{}\n"), true))
+
+	// Hand-written files are never overwritten without force.
+	handWritten := filepath.Join(dir, "b.tf")
+	writeFiles(t, dir, map[string]string{"b.tf": "locals {}\n"})
+	err = writeOutput(handWritten, src, []byte("{}\n"), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "was not generated by yaml2tf")
+}
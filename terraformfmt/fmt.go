@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 )
@@ -16,6 +17,17 @@ func FormatBody(body *hclwrite.Body) {
 	formatBody(body, nil)
 }
 
+// FormatSource formats a whole Terraform configuration file, like
+// terraform fmt does.
+func FormatSource(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	f, diags := hclwrite.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	FormatBody(f.Body())
+	return f.Bytes(), diags
+}
+
 func formatBody(body *hclwrite.Body, inBlocks []string) {
 	attrs := body.Attributes()
 	for name, attr := range attrs {
@@ -24,7 +36,7 @@ func formatBody(body *hclwrite.Body, inBlocks []string) {
 			body.SetAttributeRaw(name, cleanedExprTokens)
 			continue
 		}
-		cleanedExprTokens := formatValueExpr(attr.Expr().BuildTokens(nil))
+		cleanedExprTokens := FormatValueExpr(attr.Expr().BuildTokens(nil))
 		body.SetAttributeRaw(name, cleanedExprTokens)
 	}
 
@@ -40,7 +52,10 @@ func formatBody(body *hclwrite.Body, inBlocks []string) {
 	}
 }
 
-func formatValueExpr(tokens hclwrite.Tokens) hclwrite.Tokens {
+// FormatValueExpr unwraps an expression that is nothing but one
+// interpolation, like "${foo}", into the bare expression foo, as terraform fmt
+// does. Anything else is returned as it is.
+func FormatValueExpr(tokens hclwrite.Tokens) hclwrite.Tokens {
 	if len(tokens) < 5 {
 		// Can't possibly be a "${ ... }" sequence without at least enough
 		// tokens for the delimiters and one token inside them.
@@ -260,7 +275,9 @@ func trimNewlines(tokens hclwrite.Tokens) hclwrite.Tokens {
 	return tokens[start:end]
 }
 
-func bytesDiff(b1, b2 []byte, path string) (data []byte, err error) {
+// BytesDiff returns a unified diff between b1 and b2, labelled as old and new
+// versions of path. It uses the system's diff command.
+func BytesDiff(b1, b2 []byte, path string) (data []byte, err error) {
 	f1, err := ioutil.TempFile("", "")
 	if err != nil {
 		return